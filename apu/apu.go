@@ -0,0 +1,497 @@
+package apu
+
+import (
+	"gameboy/bits"
+)
+
+const (
+	// SampleRate is the number of stereo samples the APU generates each second.
+	SampleRate = 44100
+	// clockSpeed is the rate the APU is clocked at. This does not change when
+	// the CPU is running in double speed mode.
+	clockSpeed = 4194304
+	// frameSequencerPeriod is the number of cycles between each step of the
+	// frame sequencer, which runs at 512Hz.
+	frameSequencerPeriod = clockSpeed / 512
+	// maxBufferedSamples caps the number of pending samples (one second of
+	// stereo audio) so the buffer does not grow forever if nothing drains it.
+	maxBufferedSamples = SampleRate * 2
+	// chargeFactor is the amount the high-pass capacitor charge is retained
+	// between each generated sample.
+	chargeFactor = 0.996
+)
+
+// Addresses of the sound registers.
+const (
+	NR10 = 0xFF10
+	NR11 = 0xFF11
+	NR12 = 0xFF12
+	NR13 = 0xFF13
+	NR14 = 0xFF14
+	NR21 = 0xFF16
+	NR22 = 0xFF17
+	NR23 = 0xFF18
+	NR24 = 0xFF19
+	NR30 = 0xFF1A
+	NR31 = 0xFF1B
+	NR32 = 0xFF1C
+	NR33 = 0xFF1D
+	NR34 = 0xFF1E
+	NR41 = 0xFF20
+	NR42 = 0xFF21
+	NR43 = 0xFF22
+	NR44 = 0xFF23
+	NR50 = 0xFF24
+	NR51 = 0xFF25
+	NR52 = 0xFF26
+)
+
+// readMasks are the bits of each register in 0xFF10-0xFF2F which always read
+// back as 1, either because they are write-only or unused.
+var readMasks = [0x20]byte{
+	0x80, 0x3F, 0x00, 0xFF, 0xBF, // NR10-NR14
+	0xFF, 0x3F, 0x00, 0xFF, 0xBF, // NR20-NR24
+	0x7F, 0xFF, 0x9F, 0xFF, 0xBF, // NR30-NR34
+	0xFF, 0xFF, 0x00, 0x00, 0xBF, // NR40-NR44
+	0x00, 0x00, 0x70, // NR50-NR52
+	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, // Unused
+}
+
+// APU is the GameBoy's audio processing unit. It contains the two square
+// channels (the first with a frequency sweep), the wave channel and the
+// noise channel, and mixes them into stereo samples.
+type APU struct {
+	// If the APU is in CGB mode, which changes some of the power
+	// behaviour of the length counters and wave RAM.
+	cgb bool
+
+	// NR52 bit 7, if the APU is powered on.
+	enabled bool
+
+	// Raw values last written to the registers 0xFF10-0xFF2F.
+	regs [0x20]byte
+
+	chn1 square
+	chn2 square
+	chn3 wave
+	chn4 noise
+
+	// The next step of the frame sequencer (0-7) and the number of
+	// cycles since the last step.
+	frameStep    int
+	frameCounter int
+
+	// Fixed point counter used to generate samples at SampleRate.
+	sampleCounter int
+
+	// Mask of channels which have been muted in the mixer, with bit 0 for
+	// channel 1. Muted channels still run, they are just not heard.
+	muted byte
+
+	// Capacitor charge of the left and right high-pass filters.
+	capLeft, capRight float64
+
+	// Interleaved stereo samples generated since they were last drained.
+	samples []int16
+}
+
+// Init sets up the APU in its state after the boot ROM has run.
+func (a *APU) Init(cgb bool) {
+	*a = APU{cgb: cgb}
+	a.chn3.cgb = cgb
+	a.chn1.hasSweep = true
+	a.chn1.length.max = 64
+	a.chn2.length.max = 64
+	a.chn3.length.max = 256
+	a.chn4.length.max = 64
+	a.chn4.lfsr = 0x7FFF
+
+	a.Write(NR52, 0xF1)
+	a.Write(NR10, 0x80)
+	a.Write(NR11, 0xBF)
+	a.Write(NR12, 0xF3)
+	a.Write(NR14, 0xBF)
+	a.Write(NR21, 0x3F)
+	a.Write(NR22, 0x00)
+	a.Write(NR24, 0xBF)
+	a.Write(NR30, 0x7F)
+	a.Write(NR31, 0xFF)
+	a.Write(NR32, 0x9F)
+	a.Write(NR34, 0xBF)
+	a.Write(NR41, 0xFF)
+	a.Write(NR42, 0x00)
+	a.Write(NR43, 0x00)
+	a.Write(NR44, 0xBF)
+	a.Write(NR50, 0x77)
+	a.Write(NR51, 0xF3)
+}
+
+// Buffer advances the APU by a number of CPU cycles. The speed is the current
+// CPU speed multiplier, as the APU is not affected by double speed mode.
+func (a *APU) Buffer(cpuTicks int, speed int) {
+	ticks := cpuTicks / speed
+	for ticks > 0 {
+		// Step up to the point where the next sample is generated.
+		step := (clockSpeed - a.sampleCounter + SampleRate - 1) / SampleRate
+		if step > ticks {
+			step = ticks
+		}
+		a.tick(step)
+		ticks -= step
+
+		a.sampleCounter += step * SampleRate
+		if a.sampleCounter >= clockSpeed {
+			a.sampleCounter -= clockSpeed
+			a.generateSample()
+		}
+	}
+}
+
+// Samples returns the interleaved stereo samples generated since the last
+// call and clears the internal buffer.
+func (a *APU) Samples() []int16 {
+	samples := a.samples
+	a.samples = nil
+	return samples
+}
+
+// ToggleSoundChannel mutes or unmutes one of the four channels (1-4) in
+// the mixer.
+func (a *APU) ToggleSoundChannel(channel int) {
+	a.SetChannelEnabled(channel, !a.ChannelEnabled(channel))
+}
+
+// SetChannelEnabled sets if one of the four channels (1-4) is heard in the
+// mixer. This does not affect the state of the channel seen by the game.
+func (a *APU) SetChannelEnabled(channel int, on bool) {
+	if channel < 1 || channel > 4 {
+		return
+	}
+	if on {
+		a.muted = bits.Reset(a.muted, byte(channel-1))
+	} else {
+		a.muted = bits.Set(a.muted, byte(channel-1))
+	}
+}
+
+// ChannelEnabled returns if a channel (1-4) is heard in the mixer.
+func (a *APU) ChannelEnabled(channel int) bool {
+	if channel < 1 || channel > 4 {
+		return false
+	}
+	return !bits.Test(a.muted, byte(channel-1))
+}
+
+func (a *APU) tick(cycles int) {
+	// The frame sequencer is driven by the divider, so it keeps its phase
+	// while the APU is powered off.
+	a.frameCounter += cycles
+	for a.frameCounter >= frameSequencerPeriod {
+		a.frameCounter -= frameSequencerPeriod
+		if a.enabled {
+			a.clockFrameSequencer()
+		}
+	}
+	if !a.enabled {
+		return
+	}
+	a.chn1.tick(cycles)
+	a.chn2.tick(cycles)
+	a.chn3.tick(cycles)
+	a.chn4.tick(cycles)
+}
+
+// clockFrameSequencer performs the next step of the frame sequencer. The
+// length counters are clocked on every even step, the sweep on steps 2 and 6
+// and the volume envelopes on step 7.
+func (a *APU) clockFrameSequencer() {
+	switch a.frameStep {
+	case 0, 4:
+		a.clockLengths()
+	case 2, 6:
+		a.clockLengths()
+		a.chn1.clockSweep()
+	case 7:
+		a.chn1.env.clock()
+		a.chn2.env.clock()
+		a.chn4.env.clock()
+	}
+	a.frameStep = (a.frameStep + 1) & 7
+}
+
+func (a *APU) clockLengths() {
+	if a.chn1.length.clock() {
+		a.chn1.enabled = false
+	}
+	if a.chn2.length.clock() {
+		a.chn2.enabled = false
+	}
+	if a.chn3.length.clock() {
+		a.chn3.enabled = false
+	}
+	if a.chn4.length.clock() {
+		a.chn4.enabled = false
+	}
+}
+
+// lengthFirstHalf returns if the next frame sequencer step will not clock
+// the length counters. Enabling or triggering a length counter in this half
+// of the period clocks it an extra time.
+func (a *APU) lengthFirstHalf() bool {
+	return a.frameStep&1 == 1
+}
+
+// generateSample mixes the current output of each channel into a stereo
+// sample and appends it to the sample buffer.
+func (a *APU) generateSample() {
+	var left, right float64
+	if a.enabled {
+		outputs := [4]float64{
+			dac(a.chn1.dacEnabled, a.chn1.output()),
+			dac(a.chn2.dacEnabled, a.chn2.output()),
+			dac(a.chn3.dacEnabled, a.chn3.output()),
+			dac(a.chn4.dacEnabled, a.chn4.output()),
+		}
+		panning := a.regs[NR51-NR10]
+		for i, out := range outputs {
+			if bits.Test(a.muted, byte(i)) {
+				continue
+			}
+			if bits.Test(panning, byte(i+4)) {
+				left += out
+			}
+			if bits.Test(panning, byte(i)) {
+				right += out
+			}
+		}
+		volume := a.regs[NR50-NR10]
+		left *= float64((volume>>4)&0x7+1) / 8
+		right *= float64(volume&0x7+1) / 8
+	}
+	left = a.highPass(&a.capLeft, left/4)
+	right = a.highPass(&a.capRight, right/4)
+
+	if len(a.samples) >= maxBufferedSamples {
+		return
+	}
+	a.samples = append(a.samples, toSample(left), toSample(right))
+}
+
+// highPass removes the DC offset from the output, emulating the capacitor
+// on the GameBoy's sound output.
+func (a *APU) highPass(charge *float64, in float64) float64 {
+	out := in - *charge
+	*charge = in - out*chargeFactor
+	return out
+}
+
+// dac converts the digital 0-15 output of a channel into an analog value
+// between -1 and 1. If the DAC is off it outputs nothing.
+func dac(enabled bool, value byte) float64 {
+	if !enabled {
+		return 0
+	}
+	return 1 - float64(value)/7.5
+}
+
+func toSample(value float64) int16 {
+	value *= 0x7FFF
+	switch {
+	case value > 0x7FFF:
+		return 0x7FFF
+	case value < -0x8000:
+		return -0x8000
+	}
+	return int16(value)
+}
+
+// Read returns the value of a sound register between 0xFF10 and 0xFF2F.
+func (a *APU) Read(address uint16) byte {
+	index := address - NR10
+	if address == NR52 {
+		return readMasks[index] | a.status()
+	}
+	return a.regs[index] | readMasks[index]
+}
+
+// Register returns the raw value of a sound register between 0xFF10 and
+// 0xFF3F, without the bits which always read back as 1 and without the
+// limits on reading the wave RAM while it is playing. The trigger bit of
+// NRx4 is left out, as it is not kept once the channel has started. It is
+// used for save states which store the values written to the registers.
+func (a *APU) Register(address uint16) byte {
+	switch address {
+	case NR14, NR24, NR34, NR44:
+		return a.regs[address-NR10] &^ 0x80
+	case NR52:
+		return a.status()
+	}
+	if address >= 0xFF30 {
+		return a.chn3.ram[address-0xFF30]
+	}
+	return a.regs[address-NR10]
+}
+
+// status returns the power and channel bits of NR52.
+func (a *APU) status() byte {
+	status := bits.B(a.enabled) << 7
+	status |= bits.B(a.chn1.enabled)
+	status |= bits.B(a.chn2.enabled) << 1
+	status |= bits.B(a.chn3.enabled) << 2
+	status |= bits.B(a.chn4.enabled) << 3
+	return status
+}
+
+// Write sets the value of a sound register between 0xFF10 and 0xFF2F.
+func (a *APU) Write(address uint16, value byte) {
+	if address == NR52 {
+		a.setPower(bits.Test(value, 7))
+		return
+	}
+	if !a.enabled {
+		// When powered off the registers are read only, except on DMG
+		// where the length counters can still be loaded.
+		if !a.cgb {
+			switch address {
+			case NR11:
+				a.chn1.length.load(value & 0x3F)
+			case NR21:
+				a.chn2.length.load(value & 0x3F)
+			case NR31:
+				a.chn3.length.load(value)
+			case NR41:
+				a.chn4.length.load(value & 0x3F)
+			}
+		}
+		return
+	}
+	a.regs[address-NR10] = value
+
+	switch address {
+	case NR10:
+		a.chn1.writeSweep(value)
+	case NR11:
+		a.chn1.duty = value >> 6
+		a.chn1.length.load(value & 0x3F)
+	case NR12:
+		a.chn1.env.write(value)
+		a.chn1.dacEnabled = value&0xF8 != 0
+		a.chn1.enabled = a.chn1.enabled && a.chn1.dacEnabled
+	case NR13:
+		a.chn1.freq = a.chn1.freq&0x700 | uint16(value)
+	case NR14:
+		a.chn1.freq = a.chn1.freq&0xFF | uint16(value&0x7)<<8
+		a.writeControl(&a.chn1.enabled, &a.chn1.length, value, a.chn1.trigger)
+
+	case NR21:
+		a.chn2.duty = value >> 6
+		a.chn2.length.load(value & 0x3F)
+	case NR22:
+		a.chn2.env.write(value)
+		a.chn2.dacEnabled = value&0xF8 != 0
+		a.chn2.enabled = a.chn2.enabled && a.chn2.dacEnabled
+	case NR23:
+		a.chn2.freq = a.chn2.freq&0x700 | uint16(value)
+	case NR24:
+		a.chn2.freq = a.chn2.freq&0xFF | uint16(value&0x7)<<8
+		a.writeControl(&a.chn2.enabled, &a.chn2.length, value, a.chn2.trigger)
+
+	case NR30:
+		a.chn3.dacEnabled = bits.Test(value, 7)
+		a.chn3.enabled = a.chn3.enabled && a.chn3.dacEnabled
+	case NR31:
+		a.chn3.length.load(value)
+	case NR32:
+		a.chn3.volume = (value >> 5) & 0x3
+	case NR33:
+		a.chn3.freq = a.chn3.freq&0x700 | uint16(value)
+	case NR34:
+		a.chn3.freq = a.chn3.freq&0xFF | uint16(value&0x7)<<8
+		a.writeControl(&a.chn3.enabled, &a.chn3.length, value, a.chn3.trigger)
+
+	case NR41:
+		a.chn4.length.load(value & 0x3F)
+	case NR42:
+		a.chn4.env.write(value)
+		a.chn4.dacEnabled = value&0xF8 != 0
+		a.chn4.enabled = a.chn4.enabled && a.chn4.dacEnabled
+	case NR43:
+		a.chn4.writePolynomial(value)
+	case NR44:
+		a.writeControl(&a.chn4.enabled, &a.chn4.length, value, a.chn4.trigger)
+	}
+}
+
+// writeControl handles a write to the NRx4 register of a channel, which
+// enables the length counter and can trigger the channel.
+func (a *APU) writeControl(enabled *bool, length *lengthCounter, value byte, trigger func()) {
+	wasEnabled := length.enabled
+	length.enabled = bits.Test(value, 6)
+	triggered := bits.Test(value, 7)
+
+	// Enabling the length counter in the first half of the length period
+	// clocks it once, which can disable the channel.
+	if !wasEnabled && length.enabled && a.lengthFirstHalf() && length.counter > 0 {
+		length.counter--
+		if length.counter == 0 && !triggered {
+			*enabled = false
+		}
+	}
+
+	if triggered {
+		if length.counter == 0 {
+			length.counter = length.max
+			if length.enabled && a.lengthFirstHalf() {
+				length.counter--
+			}
+		}
+		trigger()
+	}
+}
+
+// ReadWaveform returns a value from the wave pattern RAM in 0xFF30-0xFF3F.
+func (a *APU) ReadWaveform(address uint16) byte {
+	return a.chn3.readRAM(address - 0xFF30)
+}
+
+// WriteWaveform sets a value in the wave pattern RAM in 0xFF30-0xFF3F.
+func (a *APU) WriteWaveform(address uint16, value byte) {
+	a.chn3.writeRAM(address-0xFF30, value)
+}
+
+// setPower turns the APU on or off using NR52. Turning it off clears all of
+// the sound registers.
+func (a *APU) setPower(on bool) {
+	if on == a.enabled {
+		return
+	}
+	if !on {
+		lengths := [4]lengthCounter{a.chn1.length, a.chn2.length, a.chn3.length, a.chn4.length}
+		for address := uint16(NR10); address < NR52; address++ {
+			a.Write(address, 0)
+		}
+		a.chn1.enabled = false
+		a.chn2.enabled = false
+		a.chn3.enabled = false
+		a.chn4.enabled = false
+
+		// On DMG the length counters are unaffected by power, on CGB they
+		// are cleared.
+		if a.cgb {
+			lengths = [4]lengthCounter{}
+		}
+		a.chn1.length.counter = lengths[0].counter
+		a.chn2.length.counter = lengths[1].counter
+		a.chn3.length.counter = lengths[2].counter
+		a.chn4.length.counter = lengths[3].counter
+	} else {
+		// Powering on resets the frame sequencer so the next step is 0, and
+		// the square duty and wave sample positions.
+		a.frameStep = 0
+		a.chn1.dutyStep = 0
+		a.chn2.dutyStep = 0
+		a.chn3.position = 0
+		a.chn3.sample = 0
+	}
+	a.enabled = on
+}
@@ -0,0 +1,342 @@
+package apu
+
+import (
+	"gameboy/bits"
+)
+
+// lengthCounter disables a channel once it has been clocked enough times
+// by the frame sequencer.
+type lengthCounter struct {
+	max     int
+	counter int
+	enabled bool
+}
+
+// load sets the counter from the length value written to an NRx1 register.
+func (l *lengthCounter) load(value byte) {
+	l.counter = l.max - int(value)
+}
+
+// clock decrements the counter if it is enabled, and returns true if it has
+// just reached zero and the channel should be disabled.
+func (l *lengthCounter) clock() bool {
+	if !l.enabled || l.counter == 0 {
+		return false
+	}
+	l.counter--
+	return l.counter == 0
+}
+
+// envelope periodically increases or decreases the volume of a channel.
+type envelope struct {
+	initial  byte
+	increase bool
+	period   byte
+
+	volume byte
+	timer  byte
+}
+
+// write sets the envelope from a value written to an NRx2 register.
+func (e *envelope) write(value byte) {
+	e.initial = value >> 4
+	e.increase = bits.Test(value, 3)
+	e.period = value & 0x7
+}
+
+func (e *envelope) trigger() {
+	e.volume = e.initial
+	e.timer = e.period
+	if e.timer == 0 {
+		e.timer = 8
+	}
+}
+
+func (e *envelope) clock() {
+	if e.period == 0 {
+		return
+	}
+	e.timer--
+	if e.timer > 0 {
+		return
+	}
+	e.timer = e.period
+	if e.increase && e.volume < 15 {
+		e.volume++
+	} else if !e.increase && e.volume > 0 {
+		e.volume--
+	}
+}
+
+// dutyPatterns are the waveforms of the square channels for each duty.
+var dutyPatterns = [4][8]byte{
+	{0, 0, 0, 0, 0, 0, 0, 1}, // 12.5%
+	{1, 0, 0, 0, 0, 0, 0, 1}, // 25%
+	{1, 0, 0, 0, 0, 1, 1, 1}, // 50%
+	{0, 1, 1, 1, 1, 1, 1, 0}, // 75%
+}
+
+// square is a square wave channel. Channel 1 additionally has a frequency
+// sweep unit.
+type square struct {
+	enabled    bool
+	dacEnabled bool
+
+	length lengthCounter
+	env    envelope
+
+	duty     byte
+	dutyStep byte
+	freq     uint16
+	timer    int
+
+	hasSweep     bool
+	sweepPeriod  byte
+	sweepNegate  bool
+	sweepShift   byte
+	sweepTimer   byte
+	sweepEnabled bool
+	shadowFreq   uint16
+	// Set if a sweep calculation has used negate mode since the last
+	// trigger. Clearing negate mode after this disables the channel.
+	negateUsed bool
+}
+
+func (s *square) tick(cycles int) {
+	s.timer -= cycles
+	for s.timer <= 0 {
+		s.timer += (2048 - int(s.freq)) * 4
+		s.dutyStep = (s.dutyStep + 1) & 7
+	}
+}
+
+func (s *square) output() byte {
+	if !s.enabled {
+		return 0
+	}
+	return dutyPatterns[s.duty][s.dutyStep] * s.env.volume
+}
+
+func (s *square) trigger() {
+	s.enabled = s.dacEnabled
+	s.timer = (2048 - int(s.freq)) * 4
+	s.env.trigger()
+
+	if !s.hasSweep {
+		return
+	}
+	s.shadowFreq = s.freq
+	s.reloadSweepTimer()
+	s.sweepEnabled = s.sweepPeriod != 0 || s.sweepShift != 0
+	s.negateUsed = false
+	if s.sweepShift != 0 {
+		s.calculateSweep()
+	}
+}
+
+// writeSweep sets the sweep from a value written to NR10.
+func (s *square) writeSweep(value byte) {
+	s.sweepPeriod = (value >> 4) & 0x7
+	negate := bits.Test(value, 3)
+	s.sweepShift = value & 0x7
+	if s.sweepNegate && !negate && s.negateUsed {
+		s.enabled = false
+	}
+	s.sweepNegate = negate
+}
+
+func (s *square) reloadSweepTimer() {
+	s.sweepTimer = s.sweepPeriod
+	if s.sweepTimer == 0 {
+		s.sweepTimer = 8
+	}
+}
+
+// calculateSweep returns the next frequency of the sweep, disabling the
+// channel if it overflows.
+func (s *square) calculateSweep() uint16 {
+	delta := s.shadowFreq >> s.sweepShift
+	freq := s.shadowFreq + delta
+	if s.sweepNegate {
+		freq = s.shadowFreq - delta
+		s.negateUsed = true
+	}
+	if freq > 2047 {
+		s.enabled = false
+	}
+	return freq
+}
+
+func (s *square) clockSweep() {
+	s.sweepTimer--
+	if s.sweepTimer > 0 {
+		return
+	}
+	s.reloadSweepTimer()
+	if !s.sweepEnabled || s.sweepPeriod == 0 {
+		return
+	}
+	freq := s.calculateSweep()
+	if freq <= 2047 && s.sweepShift != 0 {
+		s.shadowFreq = freq
+		s.freq = freq
+		s.calculateSweep()
+	}
+}
+
+// volumeShifts maps the NR32 output level to how far the wave samples are
+// shifted right: mute, 100%, 50% and 25%.
+var volumeShifts = [4]byte{4, 0, 1, 2}
+
+// wave is the channel which plays back the 4-bit samples in wave RAM.
+type wave struct {
+	enabled    bool
+	dacEnabled bool
+
+	length lengthCounter
+
+	volume   byte
+	freq     uint16
+	timer    int
+	position byte
+	sample   byte
+
+	// Number of cycles since the last sample was read from wave RAM.
+	sinceRead int
+
+	ram [16]byte
+
+	// On DMG wave RAM can only be accessed while the channel is playing on
+	// the same cycle as it reads a sample.
+	cgb bool
+}
+
+func (w *wave) tick(cycles int) {
+	w.sinceRead += cycles
+	w.timer -= cycles
+	for w.timer <= 0 {
+		w.sinceRead = -w.timer
+		w.timer += (2048 - int(w.freq)) * 2
+		w.position = (w.position + 1) & 31
+		w.sample = w.ram[w.position/2]
+		if w.position&1 == 0 {
+			w.sample >>= 4
+		}
+		w.sample &= 0xF
+	}
+}
+
+func (w *wave) output() byte {
+	if !w.enabled {
+		return 0
+	}
+	return w.sample >> volumeShifts[w.volume]
+}
+
+func (w *wave) trigger() {
+	// On DMG retriggering the channel just as it reads a sample corrupts
+	// the first bytes of wave RAM with the bytes around the next sample.
+	if !w.cgb && w.enabled && w.timer <= 2 {
+		index := int((w.position+1)&31) / 2
+		if index < 4 {
+			w.ram[0] = w.ram[index]
+		} else {
+			copy(w.ram[0:4], w.ram[index&^3:index&^3+4])
+		}
+	}
+	w.enabled = w.dacEnabled
+	// The first sample is read 6 cycles later than a normal period. As the
+	// APU is ticked after the triggering instruction has finished, the 8
+	// cycles of the instruction after the write have already passed.
+	w.timer = (2048-int(w.freq))*2 - 2
+	w.position = 0
+}
+
+// readRAM returns a byte of wave RAM. While the channel is playing only the
+// byte currently being played can be accessed.
+func (w *wave) readRAM(index uint16) byte {
+	if w.enabled {
+		if !w.canAccessRAM() {
+			return 0xFF
+		}
+		return w.ram[w.position/2]
+	}
+	return w.ram[index]
+}
+
+func (w *wave) writeRAM(index uint16, value byte) {
+	if w.enabled {
+		if w.canAccessRAM() {
+			w.ram[w.position/2] = value
+		}
+		return
+	}
+	w.ram[index] = value
+}
+
+// canAccessRAM returns if wave RAM can be accessed while the channel is
+// playing. On DMG this is only on the cycle a sample is being read.
+func (w *wave) canAccessRAM() bool {
+	return w.cgb || w.sinceRead == 0
+}
+
+// noise is the channel which outputs pseudo-random noise from a linear
+// feedback shift register.
+type noise struct {
+	enabled    bool
+	dacEnabled bool
+
+	length lengthCounter
+	env    envelope
+
+	shift   byte
+	width7  bool
+	divisor byte
+	timer   int
+	lfsr    uint16
+}
+
+// writePolynomial sets the noise frequency and LFSR width from NR43.
+func (n *noise) writePolynomial(value byte) {
+	n.shift = value >> 4
+	n.width7 = bits.Test(value, 3)
+	n.divisor = value & 0x7
+}
+
+func (n *noise) period() int {
+	divisor := 8
+	if n.divisor > 0 {
+		divisor = int(n.divisor) * 16
+	}
+	return divisor << n.shift
+}
+
+func (n *noise) tick(cycles int) {
+	n.timer -= cycles
+	for n.timer <= 0 {
+		n.timer += n.period()
+		// The LFSR is not clocked with shifts of 14 and 15.
+		if n.shift >= 14 {
+			continue
+		}
+		feedback := (n.lfsr ^ (n.lfsr >> 1)) & 1
+		n.lfsr = n.lfsr>>1 | feedback<<14
+		if n.width7 {
+			n.lfsr = n.lfsr&^(1<<6) | feedback<<6
+		}
+	}
+}
+
+func (n *noise) output() byte {
+	if !n.enabled || n.lfsr&1 == 1 {
+		return 0
+	}
+	return n.env.volume
+}
+
+func (n *noise) trigger() {
+	n.enabled = n.dacEnabled
+	n.timer = n.period()
+	n.env.trigger()
+	n.lfsr = 0x7FFF
+}
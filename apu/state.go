@@ -0,0 +1,44 @@
+package apu
+
+import "gameboy/savestate"
+
+// SyncState saves or loads the state of the APU. The samples waiting to be
+// drained and the muted channels are not part of the state.
+func (a *APU) SyncState(s *savestate.State) {
+	s.Sync(&a.cgb, &a.enabled, &a.regs)
+	a.chn1.syncState(s)
+	a.chn2.syncState(s)
+	a.chn3.syncState(s)
+	a.chn4.syncState(s)
+	s.Sync(&a.frameStep, &a.frameCounter, &a.sampleCounter, &a.capLeft, &a.capRight)
+}
+
+func (l *lengthCounter) syncState(s *savestate.State) {
+	s.Sync(&l.max, &l.counter, &l.enabled)
+}
+
+func (e *envelope) syncState(s *savestate.State) {
+	s.Sync(&e.initial, &e.increase, &e.period, &e.volume, &e.timer)
+}
+
+func (sq *square) syncState(s *savestate.State) {
+	s.Sync(&sq.enabled, &sq.dacEnabled)
+	sq.length.syncState(s)
+	sq.env.syncState(s)
+	s.Sync(&sq.duty, &sq.dutyStep, &sq.freq, &sq.timer)
+	s.Sync(&sq.hasSweep, &sq.sweepPeriod, &sq.sweepNegate, &sq.sweepShift,
+		&sq.sweepTimer, &sq.sweepEnabled, &sq.shadowFreq, &sq.negateUsed)
+}
+
+func (w *wave) syncState(s *savestate.State) {
+	s.Sync(&w.enabled, &w.dacEnabled)
+	w.length.syncState(s)
+	s.Sync(&w.volume, &w.freq, &w.timer, &w.position, &w.sample, &w.sinceRead, &w.ram, &w.cgb)
+}
+
+func (n *noise) syncState(s *savestate.State) {
+	s.Sync(&n.enabled, &n.dacEnabled)
+	n.length.syncState(s)
+	n.env.syncState(s)
+	s.Sync(&n.shift, &n.width7, &n.divisor, &n.timer, &n.lfsr)
+}
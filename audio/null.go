@@ -0,0 +1,13 @@
+package audio
+
+// NullBinding is an audio output which discards all of the sound, for running
+// muted or without an audio device.
+type NullBinding struct{}
+
+// Play discards the samples.
+func (NullBinding) Play(samples []int16) {}
+
+// Close does nothing.
+func (NullBinding) Close() error {
+	return nil
+}
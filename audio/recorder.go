@@ -0,0 +1,60 @@
+package audio
+
+import (
+	"encoding/binary"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Recorder writes the sound to a file. Files with a .wav extension are
+// written as a WAV file, anything else as raw 16-bit little endian stereo PCM.
+// Recorder can be used directly as an audio output.
+type Recorder struct {
+	file *os.File
+	wav  *WAVWriter
+}
+
+// NewRecorder creates the file to record the sound to.
+func NewRecorder(filename string, sampleRate int) (*Recorder, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	recorder := &Recorder{file: file}
+	if strings.EqualFold(filepath.Ext(filename), ".wav") {
+		recorder.wav, err = NewWAVWriter(file, sampleRate)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return recorder, nil
+}
+
+// Write appends interleaved stereo samples to the recording.
+func (r *Recorder) Write(samples []int16) error {
+	if r.wav != nil {
+		return r.wav.Write(samples)
+	}
+	return binary.Write(r.file, binary.LittleEndian, samples)
+}
+
+// Play writes the samples to the recording.
+func (r *Recorder) Play(samples []int16) {
+	if err := r.Write(samples); err != nil {
+		log.Printf("Failed to record audio: %v", err)
+	}
+}
+
+// Close finishes the WAV file if there is one and closes the recording file.
+func (r *Recorder) Close() error {
+	if r.wav != nil {
+		if err := r.wav.Close(); err != nil {
+			r.file.Close()
+			return err
+		}
+	}
+	return r.file.Close()
+}
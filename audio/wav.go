@@ -0,0 +1,86 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	wavChannels      = 2
+	wavBitsPerSample = 16
+	wavHeaderSize    = 44
+)
+
+// WAVWriter writes 16-bit stereo samples to a WAV file.
+type WAVWriter struct {
+	w          io.WriteSeeker
+	buf        *bufio.Writer
+	sampleRate int
+	dataSize   uint32
+}
+
+// NewWAVWriter writes the WAV header to w and returns a writer for the
+// samples. The samples are buffered and the sizes in the header are only
+// filled in by Close, so the file is not valid until it is closed.
+func NewWAVWriter(w io.WriteSeeker, sampleRate int) (*WAVWriter, error) {
+	writer := &WAVWriter{
+		w:          w,
+		buf:        bufio.NewWriter(w),
+		sampleRate: sampleRate,
+	}
+	if err := writer.writeHeader(writer.buf); err != nil {
+		return nil, fmt.Errorf("failed to write wav header: %w", err)
+	}
+	return writer, nil
+}
+
+func (w *WAVWriter) writeHeader(dst io.Writer) error {
+	blockAlign := wavChannels * wavBitsPerSample / 8
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(wavHeaderSize - 8 + w.dataSize),
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16), // Size of the fmt chunk
+		uint16(1),  // PCM format
+		uint16(wavChannels),
+		uint32(w.sampleRate),
+		uint32(w.sampleRate * blockAlign), // Bytes per second
+		uint16(blockAlign),
+		uint16(wavBitsPerSample),
+		[4]byte{'d', 'a', 't', 'a'},
+		w.dataSize,
+	}
+	for _, field := range header {
+		if err := binary.Write(dst, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write appends interleaved stereo samples to the file.
+func (w *WAVWriter) Write(samples []int16) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	if err := binary.Write(w.buf, binary.LittleEndian, samples); err != nil {
+		return err
+	}
+	w.dataSize += uint32(len(samples) * 2)
+	return nil
+}
+
+// Close writes out the buffered samples and goes back to fill in the sizes
+// in the header. It does not close the underlying writer.
+func (w *WAVWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if _, err := w.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return w.writeHeader(w.w)
+}
@@ -0,0 +1,45 @@
+package audio
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWAVRecording(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "sound.wav")
+	recorder, err := NewRecorder(filename, 48000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := recorder.Write([]int16{1, -1, 2, -2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const dataSize = 3 * 4 * 2
+	if len(data) != wavHeaderSize+dataSize {
+		t.Fatalf("file is %d bytes, want %d", len(data), wavHeaderSize+dataSize)
+	}
+	if got := binary.LittleEndian.Uint32(data[4:]); got != wavHeaderSize-8+dataSize {
+		t.Errorf("RIFF size = %d, want %d", got, wavHeaderSize-8+dataSize)
+	}
+	if got := binary.LittleEndian.Uint32(data[24:]); got != 48000 {
+		t.Errorf("sample rate = %d, want 48000", got)
+	}
+	if got := binary.LittleEndian.Uint32(data[40:]); got != dataSize {
+		t.Errorf("data size = %d, want %d", got, dataSize)
+	}
+	if got := int16(binary.LittleEndian.Uint16(data[wavHeaderSize+2:])); got != -1 {
+		t.Errorf("second sample = %d, want -1", got)
+	}
+}
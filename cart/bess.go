@@ -0,0 +1,101 @@
+package cart
+
+// RegisterWrite is a write of a value to one of the cart's registers.
+type RegisterWrite struct {
+	Address uint16
+	Value   byte
+}
+
+// registerController is implemented by the banking controllers which have
+// registers for selecting banks.
+type registerController interface {
+	registerWrites() []RegisterWrite
+}
+
+// RegisterWrites returns the writes to the cart's registers which put a new
+// cart into the same banking state as this one. They are used for the MBC
+// block of BESS save states, which other emulators replay to restore the
+// cart.
+func (c *Cart) RegisterWrites() []RegisterWrite {
+	if r, ok := c.BankingController.(registerController); ok {
+		return r.registerWrites()
+	}
+	return nil
+}
+
+// RAMData returns the contents of the cart RAM, without any RTC data.
+func (c *Cart) RAMData() []byte {
+	data := c.GetSaveData()
+	return data[:len(data)-rtcFooterLength(data)]
+}
+
+// LoadRAMData sets the contents of the cart RAM.
+func (c *Cart) LoadRAMData(data []byte) {
+	c.LoadSaveData(data[:len(data)-rtcFooterLength(data)])
+}
+
+// RTCData returns the registers of the real time clock in the 48 byte
+// format used in save files, or nil if the cart does not have one.
+func (c *Cart) RTCData() []byte {
+	if r := c.getRTC(); r != nil {
+		return r.saveData()
+	}
+	return nil
+}
+
+// LoadRTCData restores the registers of the real time clock from data in
+// the format returned by RTCData.
+func (c *Cart) LoadRTCData(data []byte) {
+	if r := c.getRTC(); r != nil && len(data) >= rtcFooterSizeShort {
+		r.loadData(data)
+	}
+}
+
+// enableValue returns the value written to enable or disable the RAM.
+func enableValue(enabled bool) byte {
+	if enabled {
+		return 0x0A
+	}
+	return 0x00
+}
+
+func (r *MBC1) registerWrites() []RegisterWrite {
+	mode, upper := byte(0), byte(r.romBank>>5)&0x3
+	if !r.romBanking {
+		mode, upper = 1, byte(r.ramBank)
+	}
+	return []RegisterWrite{
+		{0x0000, enableValue(r.ramEnabled)},
+		{0x6000, mode},
+		{0x2000, byte(r.romBank) & 0x1F},
+		{0x4000, upper},
+	}
+}
+
+func (r *MBC2) registerWrites() []RegisterWrite {
+	return []RegisterWrite{
+		{0x0000, enableValue(r.ramEnabled)},
+		{0x0100, byte(r.romBank)},
+	}
+}
+
+func (r *MBC3) registerWrites() []RegisterWrite {
+	return []RegisterWrite{
+		{0x0000, enableValue(r.ramEnabled)},
+		{0x2000, byte(r.romBank)},
+		{0x4000, byte(r.ramBank)},
+	}
+}
+
+func (r *MBC5) registerWrites() []RegisterWrite {
+	ramBank := byte(r.ramBank)
+	if r.rumbling {
+		ramBank |= 0x8
+	}
+	return []RegisterWrite{
+		{0x0000, enableValue(r.ramEnabled)},
+		{0x2000, byte(r.romBank)},
+		{0x3000, byte(r.romBank >> 8)},
+		{0x4000, ramBank},
+	}
+}
@@ -1,10 +1,14 @@
 package cart
 
 import (
+	"bytes"
 	"fmt"
+	"gameboy/savestate"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 type Mode int
@@ -35,36 +39,71 @@ type BankingController interface {
 	// general this will the contents of the RAM, however controllers may
 	// choose to store this data in their own format.
 
-	//GetSaveData() []byte
+	GetSaveData() []byte
 
 	// LoadSaveData loads some save data into the cartridge. The banking
 	// controller implementation can decide how this data should be loaded.
 
-	//LoadSaveData(data []byte)
+	LoadSaveData(data []byte)
+
+	// SyncState saves or loads the state of the controller, such as the
+	// selected banks and the contents of the RAM.
+	SyncState(s *savestate.State)
+}
+
+// rumbleController is implemented by the banking controllers of carts which
+// have a rumble motor.
+type rumbleController interface {
+	hasRumble() bool
+	setRumbleCallback(callback func(on bool))
+	isRumbling() bool
+}
+
+// rtcController is implemented by the banking controllers which can have a
+// real time clock. It returns nil if the cart does not have one.
+type rtcController interface {
+	realTimeClock() *rtc
+}
+
+// bankController is implemented by the banking controllers which can switch
+// the ROM bank mapped at 0x4000-0x7FFF.
+type bankController interface {
+	currentROMBank() int
 }
 
 type Cart struct {
 	BankingController
-	title    string
+	header   *Header
 	filename string
 	mode     Mode
+
+	// If the cart has a battery which keeps its RAM between sessions.
+	battery bool
+	// The save data which was last written to the save file.
+	savedData []byte
+
+	// The clock driving the RTC if it counts the emulated time rather than
+	// the time on the host.
+	clock *virtualClock
 }
 
 func (c *Cart) GetMode() Mode {
 	return c.mode
 }
 
+// Filename returns the path of the ROM file, which is empty if the cart was
+// not loaded from a file.
+func (c *Cart) Filename() string {
+	return c.filename
+}
+
 func (c *Cart) GetName() string {
-	if c.title == "" {
-		for i := uint16(0x0134); i < 0x142; i++ {
-			chr := c.Read(i)
-			if chr != 0x00 {
-				c.title += string(chr)
-			}
-		}
-		c.title = strings.TrimSpace(c.title)
-	}
-	return c.title
+	return c.header.Title
+}
+
+// Header returns the information from the cartridge header.
+func (c *Cart) Header() *Header {
+	return c.header
 }
 
 func NewCartFromFile(filename string) (*Cart, error) {
@@ -72,65 +111,262 @@ func NewCartFromFile(filename string) (*Cart, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewCart(rom, filename), nil
+	return NewCart(rom, filename)
 }
 
-func NewCart(rom []byte, filename string) *Cart {
+func NewCart(rom []byte, filename string) (*Cart, error) {
+	return newCart(rom, filename, nil)
+}
+
+// NewVirtualClockCart creates a cart whose RTC counts the time emulated by
+// the CPU starting from epoch, like UseVirtualClock. The clock is chosen
+// before the save file is loaded, so no time on the host is counted.
+func NewVirtualClockCart(rom []byte, filename string, epoch time.Time) (*Cart, error) {
+	return newCart(rom, filename, &epoch)
+}
+
+func newCart(rom []byte, filename string, epoch *time.Time) (*Cart, error) {
+	header, err := ParseHeader(rom)
+	if err != nil {
+		return nil, err
+	}
 	cartridge := Cart{
+		header:   header,
 		filename: filename,
 	}
 
 	// Check for GB mode
-	switch rom[0x0143] {
-	case 0x80:
-		cartridge.mode = DMG | CGB
-	case 0xC0:
+	switch {
+	case header.CGBOnly():
 		cartridge.mode = CGB
+	case header.SupportsCGB():
+		cartridge.mode = DMG | CGB
 	default:
 		cartridge.mode = DMG
 	}
 
 	// Determine cartridge type
-	mbcFlag := rom[0x147]
-	cartType := "Unknown"
+	mbcFlag := header.CartType
 	switch mbcFlag {
 	case 0x00, 0x08, 0x09, 0x0B, 0x0C, 0x0D:
-		cartType = "ROM"
 		cartridge.BankingController = NewROM(rom)
 	default:
 		switch {
 		case mbcFlag <= 0x03:
-			cartridge.BankingController = NewMBC1(rom)
-			cartType = "MBC1"
+			cartridge.BankingController = NewMBC1(rom, header.RAMSize)
 		case mbcFlag <= 0x06:
-			log.Println("Warning: MBC2 carts are not supported.")
-			//cartridge.BankingController = NewMBC2(rom)
-			//cartType = "MBC2"
+			cartridge.BankingController = NewMBC2(rom)
 		case mbcFlag <= 0x13:
-			//log.Println("Warning: MBC3 carts are not supported.")
-			cartridge.BankingController = NewMBC3(rom)
-			cartType = "MBC3"
+			cartridge.BankingController = NewMBC3(rom, header.RAMSize, mbcFlag == 0x0F || mbcFlag == 0x10)
 		case mbcFlag < 0x17:
-			log.Println("Warning: MBC4 carts are not supported.")
-			//cartridge.BankingController = NewMBC1(rom)
-			//cartType = "MBC4"
+			return nil, fmt.Errorf("unsupported cart type: %#02x", mbcFlag)
 		case mbcFlag < 0x1F:
-			//cartridge.BankingController = NewMBC5(rom)
-			//cartType = "MBC5"
+			cartridge.BankingController = NewMBC5(rom, header.RAMSize, mbcFlag >= 0x1C)
 		default:
 			log.Printf("Warning: This cart may not be supported: %02x", mbcFlag)
-			cartridge.BankingController = NewMBC1(rom)
+			cartridge.BankingController = NewMBC1(rom, header.RAMSize)
 		}
 	}
-	log.Printf("Cart type: %#02x (%v)", mbcFlag, cartType)
+	log.Printf("Cart type: %#02x (%v)", mbcFlag, header.CartTypeName())
 	log.Printf("Cart mode: %v", cartridge.mode)
-	fmt.Scanln()
 
-	// switch mbcFlag {
-	// case 0x3, 0x6, 0x9, 0xD, 0xF, 0x10, 0x13, 0x17, 0x1B, 0x1E, 0xFF:
-	// 	cartridge.initGameSaves()
-	// }
-	return &cartridge
+	if epoch != nil {
+		cartridge.UseVirtualClock(*epoch)
+	}
+	switch mbcFlag {
+	case 0x3, 0x6, 0x9, 0xD, 0xF, 0x10, 0x13, 0x17, 0x1B, 0x1E, 0xFF:
+		cartridge.initGameSaves()
+	}
+	return &cartridge, nil
+}
+
+// initGameSaves marks the cart as having a battery and loads the save file
+// next to the ROM if there is one.
+func (c *Cart) initGameSaves() {
+	c.battery = true
+	if c.filename == "" {
+		return
+	}
+	savePath := c.getSavePath()
+	data, err := os.ReadFile(savePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to load save data: %v", err)
+		}
+		return
+	}
+	c.LoadSaveData(data)
+	c.savedData = c.GetSaveData()
+	log.Printf("Loaded save data from %v", savePath)
+}
+
+// getSavePath returns the path of the save file, which is the ROM's path
+// with a .sav extension.
+func (c *Cart) getSavePath() string {
+	return strings.TrimSuffix(c.filename, filepath.Ext(c.filename)) + ".sav"
+}
+
+// Save writes the RAM of a cart with a battery to its save file. Nothing is
+// written if the data has not changed since it was last saved. The data is
+// written to a temporary file first, so a crash while saving does not
+// corrupt the existing save.
+func (c *Cart) Save() error {
+	if !c.battery || c.filename == "" {
+		return nil
+	}
+	data := c.GetSaveData()
+	if bytes.Equal(data, c.savedData) {
+		return nil
+	}
+
+	savePath := c.getSavePath()
+	tmpPath := savePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write save data: %w", err)
+	}
+	if err := os.Rename(tmpPath, savePath); err != nil {
+		return fmt.Errorf("failed to write save data: %w", err)
+	}
+	c.savedData = data
+	return nil
+}
+
+// HasRumble returns if the cart has a rumble motor.
+func (c *Cart) HasRumble() bool {
+	r, ok := c.BankingController.(rumbleController)
+	return ok && r.hasRumble()
+}
+
+// SetRumbleCallback sets a function which is called whenever the game turns
+// the rumble motor on or off, so the frontend can react to it. It does
+// nothing if the cart has no rumble motor.
+func (c *Cart) SetRumbleCallback(callback func(on bool)) {
+	if r, ok := c.BankingController.(rumbleController); ok {
+		r.setRumbleCallback(callback)
+	}
+}
+
+// IsRumbling returns if the rumble motor is currently on.
+func (c *Cart) IsRumbling() bool {
+	if r, ok := c.BankingController.(rumbleController); ok {
+		return r.isRumbling()
+	}
+	return false
+}
+
+// SyncState saves or loads the state of the cart. The RTC uses the clock it
+// used when the state was saved after loading it, either the virtual clock
+// or the time on the host.
+func (c *Cart) SyncState(s *savestate.State) {
+	virtual := c.clock != nil
+	s.Sync(&virtual)
+	if s.Loading() && virtual != (c.clock != nil) {
+		if virtual {
+			c.UseVirtualClock(time.Time{})
+		} else {
+			c.useHostClock()
+		}
+	}
+	if virtual {
+		s.Sync(&c.clock.epoch, &c.clock.cycles)
+	}
+	c.BankingController.SyncState(s)
+}
+
+// HasRTC returns if the cart has a real time clock.
+func (c *Cart) HasRTC() bool {
+	return c.getRTC() != nil
+}
+
+func (c *Cart) getRTC() *rtc {
+	if r, ok := c.BankingController.(rtcController); ok {
+		return r.realTimeClock()
+	}
+	return nil
+}
+
+// UseVirtualClock makes the RTC count the time emulated by the CPU starting
+// from epoch, instead of the time on the host, so running the same inputs
+// always gives the same result. The time already on the RTC is kept.
+func (c *Cart) UseVirtualClock(epoch time.Time) {
+	c.clock = &virtualClock{epoch: epoch}
+	if r := c.getRTC(); r != nil {
+		r.setVirtualClock(c.clock.now)
+	}
+}
+
+// useHostClock makes the RTC count the time on the host again after using
+// the virtual clock.
+func (c *Cart) useHostClock() {
+	c.clock = nil
+	if r := c.getRTC(); r != nil {
+		r.setHostClock()
+	}
+}
+
+// UsesVirtualClock returns if the RTC counts the time emulated by the CPU.
+func (c *Cart) UsesVirtualClock() bool {
+	return c.clock != nil
+}
+
+// Tick advances the virtual clock by a number of cycles of the CPU running
+// at speed. It does nothing if the virtual clock is not being used.
+func (c *Cart) Tick(cycles, speed int) {
+	if c.clock != nil {
+		c.clock.tick(cycles, speed)
+	}
+}
+
+// RTC returns the time on the RTC since day 0.
+func (c *Cart) RTC() time.Duration {
+	if r := c.getRTC(); r != nil {
+		return r.elapsed()
+	}
+	return 0
+}
+
+// SetRTC sets the RTC to a time since day 0.
+func (c *Cart) SetRTC(elapsed time.Duration) {
+	if r := c.getRTC(); r != nil {
+		r.set(elapsed)
+	}
+}
+
+// OffsetRTC moves the RTC forwards, or backwards if offset is negative. It
+// stops at day 0 when moving backwards.
+func (c *Cart) OffsetRTC(offset time.Duration) {
+	if r := c.getRTC(); r != nil {
+		elapsed := r.elapsed() + offset
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		r.set(elapsed)
+	}
+}
+
+// ramOffset returns the offset into the ram for an address in a ram bank.
+// Bank numbers wrap around the size of the ram, and carts with less than a
+// full 8KB bank repeat it through the bank.
+func ramOffset(ram []byte, bank uint32, address uint16) uint32 {
+	return ((0x2000 * bank) + uint32(address-0xA000)) % uint32(len(ram))
+}
+
+// ROMBank returns the number of the ROM bank which is mapped at
+// 0x4000-0x7FFF.
+func (c *Cart) ROMBank() int {
+	if b, ok := c.BankingController.(bankController); ok {
+		return b.currentROMBank()
+	}
+	return 1
+}
+
+// romBankCount returns the number of 16KB banks in the ROM data.
+func romBankCount(rom []byte) uint32 {
+	banks := uint32(len(rom) / 0x4000)
+	if banks == 0 {
+		return 1
+	}
+	return banks
 }
 
 func loadROMData(filename string) ([]byte, error) {
@@ -0,0 +1,26 @@
+package cart
+
+import "time"
+
+// Number of cycles the GameBoy CPU performs each second at normal speed.
+const cpuClockSpeed = 4194304
+
+// virtualClock counts the time emulated by the CPU from an epoch, rather than
+// the time passing on the host, so the RTC is the same every time a game is
+// run with the same inputs.
+type virtualClock struct {
+	epoch  time.Time
+	cycles int64
+}
+
+// tick advances the clock by a number of cycles of the CPU running at speed.
+func (c *virtualClock) tick(cycles, speed int) {
+	c.cycles += int64(cycles / speed)
+}
+
+// now returns the current time of the clock.
+func (c *virtualClock) now() time.Time {
+	seconds := c.cycles / cpuClockSpeed
+	remainder := c.cycles % cpuClockSpeed
+	return c.epoch.Add(time.Duration(seconds)*time.Second + time.Duration(remainder)*time.Second/cpuClockSpeed)
+}
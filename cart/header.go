@@ -0,0 +1,227 @@
+package cart
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Size of the ROM up to the end of the cartridge header.
+const headerEnd = 0x150
+
+// unknownRAMSize is the size of the cart RAM used when the header has a code
+// which is not known, the most the common MBC1 and MBC3 carts have.
+const unknownRAMSize = 0x8000
+
+// Header is the information in the cartridge header at 0x0100-0x014F of the
+// ROM.
+type Header struct {
+	// Title of the game in upper case ASCII.
+	Title string
+	// Manufacturer code of newer games, which is empty for older games.
+	Manufacturer string
+	// CGBFlag is 0x80 if the game supports the CGB functions, and 0xC0 if
+	// it only works on a CGB.
+	CGBFlag byte
+	// SGBFlag is 0x03 if the game supports the SGB functions.
+	SGBFlag byte
+	// Licensee is the code of the game's publisher. It is the two character
+	// new licensee code, or the old licensee code in hex for older games.
+	Licensee string
+	// CartType is the memory bank controller and other hardware in the cart.
+	CartType byte
+	// ROMSize and RAMSize are the size in bytes of the ROM and cart RAM.
+	ROMSize int
+	RAMSize int
+	// Version is the version number of the game.
+	Version byte
+	// HeaderChecksum is the checksum of the header bytes 0x0134-0x014C,
+	// which is checked by the boot ROM.
+	HeaderChecksum byte
+	// GlobalChecksum is the sum of all the bytes in the ROM except for
+	// itself. It is not checked by the GameBoy.
+	GlobalChecksum uint16
+
+	computedHeaderChecksum byte
+	computedGlobalChecksum uint16
+}
+
+// cartTypeNames are the names of the hardware for each cart type.
+var cartTypeNames = map[byte]string{
+	0x00: "ROM ONLY",
+	0x01: "MBC1",
+	0x02: "MBC1+RAM",
+	0x03: "MBC1+RAM+BATTERY",
+	0x05: "MBC2",
+	0x06: "MBC2+BATTERY",
+	0x08: "ROM+RAM",
+	0x09: "ROM+RAM+BATTERY",
+	0x0B: "MMM01",
+	0x0C: "MMM01+RAM",
+	0x0D: "MMM01+RAM+BATTERY",
+	0x0F: "MBC3+TIMER+BATTERY",
+	0x10: "MBC3+TIMER+RAM+BATTERY",
+	0x11: "MBC3",
+	0x12: "MBC3+RAM",
+	0x13: "MBC3+RAM+BATTERY",
+	0x19: "MBC5",
+	0x1A: "MBC5+RAM",
+	0x1B: "MBC5+RAM+BATTERY",
+	0x1C: "MBC5+RUMBLE",
+	0x1D: "MBC5+RUMBLE+RAM",
+	0x1E: "MBC5+RUMBLE+RAM+BATTERY",
+	0x20: "MBC6",
+	0x22: "MBC7+SENSOR+RUMBLE+RAM+BATTERY",
+	0xFC: "POCKET CAMERA",
+	0xFD: "BANDAI TAMA5",
+	0xFE: "HuC3",
+	0xFF: "HuC1+RAM+BATTERY",
+}
+
+// ParseHeader reads the cartridge header from the ROM data. An error is
+// returned if the data is too short to hold the header, or shorter than the
+// size of the ROM given in the header. Homebrew games can have size codes
+// which are not known, so for those the size of the data and unknownRAMSize
+// are used instead with a warning.
+func ParseHeader(rom []byte) (*Header, error) {
+	if len(rom) < headerEnd {
+		return nil, fmt.Errorf("rom is too small to have a cartridge header: %d bytes", len(rom))
+	}
+
+	h := &Header{
+		CGBFlag:        rom[0x143],
+		SGBFlag:        rom[0x146],
+		CartType:       rom[0x147],
+		Version:        rom[0x14C],
+		HeaderChecksum: rom[0x14D],
+		GlobalChecksum: uint16(rom[0x14E])<<8 | uint16(rom[0x14F]),
+	}
+	h.parseTitle(rom)
+
+	if rom[0x14B] == 0x33 {
+		h.Licensee = string(rom[0x144:0x146])
+	} else {
+		h.Licensee = fmt.Sprintf("%02X", rom[0x14B])
+	}
+
+	var err error
+	if h.ROMSize, err = decodeROMSize(rom[0x148]); err != nil {
+		log.Printf("Warning: %v, using the size of the rom", err)
+		h.ROMSize = len(rom)
+	}
+	if h.RAMSize, err = decodeRAMSize(rom[0x149]); err != nil {
+		log.Printf("Warning: %v, using %d bytes", err, unknownRAMSize)
+		h.RAMSize = unknownRAMSize
+	}
+	if len(rom) < h.ROMSize {
+		return nil, fmt.Errorf("rom is truncated: the header gives a size of %d bytes but it is %d bytes", h.ROMSize, len(rom))
+	}
+
+	for _, b := range rom[0x134:0x14D] {
+		h.computedHeaderChecksum = h.computedHeaderChecksum - b - 1
+	}
+	for i, b := range rom {
+		if i != 0x14E && i != 0x14F {
+			h.computedGlobalChecksum += uint16(b)
+		}
+	}
+	return h, nil
+}
+
+// parseTitle reads the title and manufacturer code. The title originally
+// took up 16 bytes, but in later games the last byte is the CGB flag and the
+// 4 before it can be the manufacturer code.
+func (h *Header) parseTitle(rom []byte) {
+	title := rom[0x134:0x144]
+	if h.SupportsCGB() {
+		title = title[:15]
+		if manufacturer := rom[0x13F:0x143]; isManufacturerCode(manufacturer) {
+			h.Manufacturer = string(manufacturer)
+			title = title[:11]
+		}
+	}
+	if end := strings.IndexByte(string(title), 0); end >= 0 {
+		title = title[:end]
+	}
+	h.Title = strings.TrimSpace(string(title))
+}
+
+// isManufacturerCode returns if the bytes are a 4 character manufacturer
+// code, which are upper case letters and digits.
+func isManufacturerCode(code []byte) bool {
+	for _, c := range code {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeROMSize returns the size in bytes of the ROM from its header code.
+func decodeROMSize(code byte) (int, error) {
+	switch {
+	case code <= 0x08:
+		return 0x8000 << code, nil
+	case code == 0x52:
+		return 72 * 0x4000, nil
+	case code == 0x53:
+		return 80 * 0x4000, nil
+	case code == 0x54:
+		return 96 * 0x4000, nil
+	}
+	return 0, fmt.Errorf("unknown rom size code in the cartridge header: %#02x", code)
+}
+
+// decodeRAMSize returns the size in bytes of the cart RAM from its header
+// code.
+func decodeRAMSize(code byte) (int, error) {
+	switch code {
+	case 0x00:
+		return 0, nil
+	case 0x01:
+		return 0x800, nil
+	case 0x02:
+		return 0x2000, nil
+	case 0x03:
+		return 0x8000, nil
+	case 0x04:
+		return 0x20000, nil
+	case 0x05:
+		return 0x10000, nil
+	}
+	return 0, fmt.Errorf("unknown ram size code in the cartridge header: %#02x", code)
+}
+
+// CartTypeName returns the name of the hardware in the cart.
+func (h *Header) CartTypeName() string {
+	if name, ok := cartTypeNames[h.CartType]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// SupportsCGB returns if the game supports the CGB functions.
+func (h *Header) SupportsCGB() bool {
+	return h.CGBFlag&0x80 != 0
+}
+
+// CGBOnly returns if the game only works on a CGB.
+func (h *Header) CGBOnly() bool {
+	return h.CGBFlag == 0xC0
+}
+
+// SupportsSGB returns if the game supports the SGB functions.
+func (h *Header) SupportsSGB() bool {
+	return h.SGBFlag == 0x03
+}
+
+// ValidHeaderChecksum returns if the header checksum matches the header.
+// The GameBoy will not run a game if it does not.
+func (h *Header) ValidHeaderChecksum() bool {
+	return h.HeaderChecksum == h.computedHeaderChecksum
+}
+
+// ValidGlobalChecksum returns if the global checksum matches the ROM.
+func (h *Header) ValidGlobalChecksum() bool {
+	return h.GlobalChecksum == h.computedGlobalChecksum
+}
@@ -0,0 +1,134 @@
+package cart
+
+import (
+	"testing"
+)
+
+// makeROM returns a ROM of the given size with the size codes set and both
+// checksums correct.
+func makeROM(size int, romCode, ramCode byte) []byte {
+	rom := make([]byte, size)
+	copy(rom[0x134:], "TESTGAME")
+	rom[0x147] = 0x03
+	rom[0x148] = romCode
+	rom[0x149] = ramCode
+	for _, b := range rom[0x134:0x14D] {
+		rom[0x14D] = rom[0x14D] - b - 1
+	}
+	var sum uint16
+	for _, b := range rom {
+		sum += uint16(b)
+	}
+	rom[0x14E] = byte(sum >> 8)
+	rom[0x14F] = byte(sum)
+	return rom
+}
+
+func TestParseHeaderSizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		romCode byte
+		ramCode byte
+		romSize int
+		ramSize int
+		err     bool
+	}{
+		{"32KB no RAM", 0x8000, 0x00, 0x00, 0x8000, 0, false},
+		{"64KB 2KB RAM", 0x10000, 0x01, 0x01, 0x10000, 0x800, false},
+		{"128KB 8KB RAM", 0x20000, 0x02, 0x02, 0x20000, 0x2000, false},
+		{"256KB 32KB RAM", 0x40000, 0x03, 0x03, 0x40000, 0x8000, false},
+		{"8MB 128KB RAM", 0x800000, 0x08, 0x04, 0x800000, 0x20000, false},
+		{"64KB RAM", 0x8000, 0x00, 0x05, 0x8000, 0x10000, false},
+		{"72 banks", 72 * 0x4000, 0x52, 0x00, 72 * 0x4000, 0, false},
+		{"80 banks", 80 * 0x4000, 0x53, 0x00, 80 * 0x4000, 0, false},
+		{"96 banks", 96 * 0x4000, 0x54, 0x00, 96 * 0x4000, 0, false},
+		{"bigger than header", 0x10000, 0x00, 0x00, 0x8000, 0, false},
+		{"unknown ROM code", 0xC000, 0x20, 0x00, 0xC000, 0, false},
+		{"unknown RAM code", 0x8000, 0x00, 0x20, 0x8000, unknownRAMSize, false},
+		{"truncated", 0x8000, 0x01, 0x00, 0, 0, true},
+		{"truncated banks", 0x40000, 0x52, 0x00, 0, 0, true},
+		{"no header", 0x14F, 0x00, 0x00, 0, 0, true},
+	}
+	for _, tt := range tests {
+		var rom []byte
+		if tt.size < headerEnd {
+			rom = make([]byte, tt.size)
+		} else {
+			rom = makeROM(tt.size, tt.romCode, tt.ramCode)
+		}
+		h, err := ParseHeader(rom)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if h.ROMSize != tt.romSize || h.RAMSize != tt.ramSize {
+			t.Errorf("%s: sizes %#x, %#x, expected %#x, %#x", tt.name, h.ROMSize, h.RAMSize, tt.romSize, tt.ramSize)
+		}
+	}
+}
+
+func TestParseHeaderChecksums(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(rom []byte)
+		header bool
+		global bool
+	}{
+		{"valid", func(rom []byte) {}, true, true},
+		{"bad header checksum", func(rom []byte) { rom[0x14D]++ }, false, false},
+		{"changed title", func(rom []byte) { rom[0x134] = 'X' }, false, false},
+		{"changed code", func(rom []byte) { rom[0x1000]++ }, true, false},
+		{"bad global checksum", func(rom []byte) { rom[0x14F]++ }, true, false},
+	}
+	for _, tt := range tests {
+		rom := makeROM(0x8000, 0x00, 0x00)
+		tt.change(rom)
+		h, err := ParseHeader(rom)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if h.ValidHeaderChecksum() != tt.header {
+			t.Errorf("%s: ValidHeaderChecksum is %v", tt.name, !tt.header)
+		}
+		if h.ValidGlobalChecksum() != tt.global {
+			t.Errorf("%s: ValidGlobalChecksum is %v", tt.name, !tt.global)
+		}
+	}
+}
+
+func TestParseHeaderTitle(t *testing.T) {
+	tests := []struct {
+		name         string
+		title        string
+		cgbFlag      byte
+		wantTitle    string
+		manufacturer string
+	}{
+		{"old game", "POKEMON RED", 0x00, "POKEMON RED", ""},
+		{"full title", "ABCDEFGHIJKLMNOP", 0x00, "ABCDEFGHIJKLMNOP", ""},
+		{"manufacturer code", "ZELDA\x00\x00\x00\x00\x00\x00AZ7E", 0x80, "ZELDA", "AZ7E"},
+	}
+	for _, tt := range tests {
+		rom := make([]byte, 0x8000)
+		copy(rom[0x134:0x144], tt.title)
+		if len(tt.title) < 16 {
+			rom[0x143] = tt.cgbFlag
+		}
+		h, err := ParseHeader(rom)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if h.Title != tt.wantTitle || h.Manufacturer != tt.manufacturer {
+			t.Errorf("%s: title %q, manufacturer %q, expected %q, %q", tt.name, h.Title, h.Manufacturer, tt.wantTitle, tt.manufacturer)
+		}
+	}
+}
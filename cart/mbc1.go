@@ -1,11 +1,13 @@
 package cart
 
-// NewMBC1 returns a new MBC1 memory controller.
-func NewMBC1(data []byte) BankingController {
+import "gameboy/savestate"
+
+// NewMBC1 returns a new MBC1 memory controller with ramSize bytes of ram.
+func NewMBC1(data []byte, ramSize int) BankingController {
 	return &MBC1{
 		rom:     data,
 		romBank: 1,
-		ram:     make([]byte, 0x8000),
+		ram:     make([]byte, ramSize),
 	}
 }
 
@@ -27,9 +29,14 @@ func (r *MBC1) Read(address uint16) byte {
 	case address < 0x4000:
 		return r.rom[address] // Bank 0 is fixed
 	case address < 0x8000:
-		return r.rom[uint32(address-0x4000)+(r.romBank*0x4000)] // Use selected rom bank
+		// Bank numbers wrap around the size of the ROM
+		bank := r.romBank % romBankCount(r.rom)
+		return r.rom[uint32(address-0x4000)+(bank*0x4000)] // Use selected rom bank
 	default:
-		return r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] // Use selected ram bank
+		if len(r.ram) == 0 {
+			return 0xFF
+		}
+		return r.ram[ramOffset(r.ram, r.ramBank, address)] // Use selected ram bank
 	}
 }
 
@@ -50,7 +57,7 @@ func (r *MBC1) WriteROM(address uint16, value byte) {
 	case address < 0x6000:
 		// ROM/RAM banking
 		if r.romBanking {
-			r.romBank = (r.romBank & 0x1F) | uint32(value&0xe0)
+			r.romBank = (r.romBank & 0x1F) | uint32(value&0x3)<<5
 			r.updateRomBankIfZero()
 		} else {
 			r.ramBank = uint32(value & 0x3)
@@ -75,8 +82,8 @@ func (r *MBC1) updateRomBankIfZero() {
 
 // WriteRAM writes data to the ram if it is enabled.
 func (r *MBC1) WriteRAM(address uint16, value byte) {
-	if r.ramEnabled {
-		r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] = value
+	if r.ramEnabled && len(r.ram) > 0 {
+		r.ram[ramOffset(r.ram, r.ramBank, address)] = value
 	}
 }
 
@@ -89,5 +96,15 @@ func (r *MBC1) GetSaveData() []byte {
 
 // LoadSaveData loads the save data into the cartridge.
 func (r *MBC1) LoadSaveData(data []byte) {
-	r.ram = data
+	copy(r.ram, data)
+}
+
+// SyncState saves or loads the banks and RAM of the controller.
+func (r *MBC1) SyncState(s *savestate.State) {
+	s.Sync(&r.romBank, r.ram, &r.ramBank, &r.ramEnabled, &r.romBanking)
+}
+
+// currentROMBank returns the ROM bank mapped at 0x4000-0x7FFF.
+func (r *MBC1) currentROMBank() int {
+	return int(r.romBank % romBankCount(r.rom))
 }
@@ -0,0 +1,90 @@
+package cart
+
+import "gameboy/savestate"
+
+// NewMBC2 returns a new MBC2 memory controller.
+func NewMBC2(data []byte) BankingController {
+	return &MBC2{
+		rom:     data,
+		romBank: 1,
+		ram:     make([]byte, 0x200),
+	}
+}
+
+// MBC2 is a GameBoy cartridge that supports up to 16 rom banks and has 512
+// half-bytes of ram built into the controller.
+type MBC2 struct {
+	rom     []byte
+	romBank uint32
+
+	ram        []byte
+	ramEnabled bool
+}
+
+// Read returns a value at a memory address in the ROM or RAM.
+func (r *MBC2) Read(address uint16) byte {
+	switch {
+	case address < 0x4000:
+		return r.rom[address] // Bank 0 is fixed
+	case address < 0x8000:
+		// Bank numbers wrap around the size of the ROM
+		bank := r.romBank % romBankCount(r.rom)
+		return r.rom[uint32(address-0x4000)+(bank*0x4000)] // Use selected rom bank
+	default:
+		if !r.ramEnabled {
+			return 0xFF
+		}
+		// Only the lower 4 bits are stored, the upper bits read as 1s
+		return r.ram[address&0x1FF] | 0xF0
+	}
+}
+
+// WriteROM attempts to switch the ROM bank or enable the RAM. Bit 8 of the
+// address selects which of the two registers is written.
+func (r *MBC2) WriteROM(address uint16, value byte) {
+	if address >= 0x4000 {
+		return
+	}
+	if address&0x100 == 0 {
+		// RAM enable
+		r.ramEnabled = value&0xF == 0xA
+	} else {
+		// ROM bank number
+		r.romBank = uint32(value & 0xF)
+		if r.romBank == 0x00 {
+			r.romBank++
+		}
+	}
+}
+
+// WriteRAM writes data to the ram if it is enabled. The 512 bytes of ram are
+// repeated through the whole of the ram address space.
+func (r *MBC2) WriteRAM(address uint16, value byte) {
+	if r.ramEnabled {
+		r.ram[address&0x1FF] = value & 0xF
+	}
+}
+
+// GetSaveData returns the save data for this banking controller.
+func (r *MBC2) GetSaveData() []byte {
+	data := make([]byte, len(r.ram))
+	copy(data, r.ram)
+	return data
+}
+
+// LoadSaveData loads the save data into the cartridge.
+func (r *MBC2) LoadSaveData(data []byte) {
+	for i := 0; i < len(r.ram) && i < len(data); i++ {
+		r.ram[i] = data[i] & 0xF
+	}
+}
+
+// SyncState saves or loads the bank and RAM of the controller.
+func (r *MBC2) SyncState(s *savestate.State) {
+	s.Sync(&r.romBank, r.ram, &r.ramEnabled)
+}
+
+// currentROMBank returns the ROM bank mapped at 0x4000-0x7FFF.
+func (r *MBC2) currentROMBank() int {
+	return int(r.romBank % romBankCount(r.rom))
+}
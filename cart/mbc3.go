@@ -1,14 +1,19 @@
 package cart
 
-// NewMBC3 returns a new MBC3 memory controller.
-func NewMBC3(data []byte) BankingController {
-	return &MBC3{
-		rom:        data,
-		romBank:    1,
-		ram:        make([]byte, 0x8000),
-		rtc:        make([]byte, 0x10),
-		latchedRtc: make([]byte, 0x10),
+import "gameboy/savestate"
+
+// NewMBC3 returns a new MBC3 memory controller with ramSize bytes of ram, and
+// a real time clock if the cart has one.
+func NewMBC3(data []byte, ramSize int, hasRTC bool) BankingController {
+	mbc := &MBC3{
+		rom:     data,
+		romBank: 1,
+		ram:     make([]byte, ramSize),
+	}
+	if hasRTC {
+		mbc.rtc = newRTC()
 	}
+	return mbc
 }
 
 // MBC3 is a GameBoy cartridge that supports rom and ram banking and possibly
@@ -21,9 +26,7 @@ type MBC3 struct {
 	ramBank    uint32
 	ramEnabled bool
 
-	rtc        []byte
-	latchedRtc []byte
-	latched    bool
+	rtc *rtc
 }
 
 // Read returns a value at a memory address in the ROM.
@@ -32,15 +35,20 @@ func (r *MBC3) Read(address uint16) byte {
 	case address < 0x4000:
 		return r.rom[address] // Bank 0 is fixed
 	case address < 0x8000:
-		return r.rom[uint32(address-0x4000)+(r.romBank*0x4000)] // Use selected rom bank
+		// Bank numbers wrap around the size of the ROM
+		bank := r.romBank % romBankCount(r.rom)
+		return r.rom[uint32(address-0x4000)+(bank*0x4000)] // Use selected rom bank
 	default:
 		if r.ramBank >= 0x4 {
-			if r.latched {
-				return r.latchedRtc[r.ramBank]
+			if r.isRTCSelected() {
+				return r.rtc.read(byte(r.ramBank - 0x8))
 			}
-			return r.rtc[r.ramBank]
+			return 0xFF
 		}
-		return r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] // Use selected ram bank
+		if len(r.ram) == 0 {
+			return 0xFF
+		}
+		return r.ram[ramOffset(r.ram, r.ramBank, address)] // Use selected ram bank
 	}
 }
 
@@ -59,34 +67,65 @@ func (r *MBC3) WriteROM(address uint16, value byte) {
 	case address < 0x6000:
 		r.ramBank = uint32(value)
 	case address < 0x8000:
-		if value == 0x1 {
-			r.latched = false
-		} else if value == 0x0 {
-			r.latched = true
-			copy(r.rtc, r.latchedRtc)
+		// Latch the RTC registers
+		if r.rtc != nil {
+			r.rtc.latch(value)
 		}
 	}
 }
 
+// isRTCSelected returns if the selected ram bank is one of the RTC registers.
+func (r *MBC3) isRTCSelected() bool {
+	return r.rtc != nil && r.ramBank >= 0x8 && r.ramBank <= 0xC
+}
+
 // WriteRAM writes data to the ram or RTC if it is enabled.
 func (r *MBC3) WriteRAM(address uint16, value byte) {
 	if r.ramEnabled {
 		if r.ramBank >= 0x4 {
-			r.rtc[r.ramBank] = value
-		} else {
-			r.ram[(0x2000*r.ramBank)+uint32(address-0xA000)] = value
+			if r.isRTCSelected() {
+				r.rtc.write(byte(r.ramBank-0x8), value)
+			}
+		} else if len(r.ram) > 0 {
+			r.ram[ramOffset(r.ram, r.ramBank, address)] = value
 		}
 	}
 }
 
-// GetSaveData returns the save data for this banking controller.
+// realTimeClock returns the RTC of the cart, or nil if it does not have one.
+func (r *MBC3) realTimeClock() *rtc {
+	return r.rtc
+}
+
+// GetSaveData returns the save data for this banking controller. If the cart
+// has a RTC its registers are appended after the RAM.
 func (r *MBC3) GetSaveData() []byte {
 	data := make([]byte, len(r.ram))
 	copy(data, r.ram)
+	if r.rtc != nil {
+		data = append(data, r.rtc.saveData()...)
+	}
 	return data
 }
 
 // LoadSaveData loads the save data into the cartridge.
 func (r *MBC3) LoadSaveData(data []byte) {
-	r.ram = data
-}
\ No newline at end of file
+	footer := rtcFooterLength(data)
+	copy(r.ram, data[:len(data)-footer])
+	if r.rtc != nil && footer > 0 {
+		r.rtc.loadData(data[len(data)-footer:])
+	}
+}
+
+// SyncState saves or loads the banks, RAM and RTC of the controller.
+func (r *MBC3) SyncState(s *savestate.State) {
+	s.Sync(&r.romBank, r.ram, &r.ramBank, &r.ramEnabled)
+	if r.rtc != nil {
+		r.rtc.syncState(s)
+	}
+}
+
+// currentROMBank returns the ROM bank mapped at 0x4000-0x7FFF.
+func (r *MBC3) currentROMBank() int {
+	return int(r.romBank % romBankCount(r.rom))
+}
@@ -0,0 +1,129 @@
+package cart
+
+import "gameboy/savestate"
+
+// NewMBC5 returns a new MBC5 memory controller with ramSize bytes of ram.
+// Carts with a rumble motor use bit 3 of the RAM bank register to turn the
+// motor on and off.
+func NewMBC5(data []byte, ramSize int, rumble bool) BankingController {
+	return &MBC5{
+		rom:     data,
+		romBank: 1,
+		ram:     make([]byte, ramSize),
+		rumble:  rumble,
+	}
+}
+
+// MBC5 is a GameBoy cartridge that supports up to 512 rom banks, 16 ram banks
+// and possibly a rumble motor.
+type MBC5 struct {
+	rom     []byte
+	romBank uint32
+
+	ram        []byte
+	ramBank    uint32
+	ramEnabled bool
+
+	rumble   bool
+	rumbling bool
+	onRumble func(on bool)
+}
+
+// Read returns a value at a memory address in the ROM or RAM.
+func (r *MBC5) Read(address uint16) byte {
+	switch {
+	case address < 0x4000:
+		return r.rom[address] // Bank 0 is fixed
+	case address < 0x8000:
+		// Bank numbers wrap around the size of the ROM
+		bank := r.romBank % romBankCount(r.rom)
+		return r.rom[uint32(address-0x4000)+(bank*0x4000)] // Use selected rom bank
+	default:
+		if !r.ramEnabled || len(r.ram) == 0 {
+			return 0xFF
+		}
+		return r.ram[ramOffset(r.ram, r.ramBank, address)] // Use selected ram bank
+	}
+}
+
+// WriteROM attempts to switch the ROM or RAM bank.
+func (r *MBC5) WriteROM(address uint16, value byte) {
+	switch {
+	case address < 0x2000:
+		// RAM enable
+		r.ramEnabled = value&0xF == 0xA
+	case address < 0x3000:
+		// ROM bank number (lower 8)
+		r.romBank = (r.romBank & 0x100) | uint32(value)
+	case address < 0x4000:
+		// ROM bank number (upper 1)
+		r.romBank = (r.romBank & 0xFF) | uint32(value&0x1)<<8
+	case address < 0x6000:
+		// RAM bank number, the rumble motor takes the place of bit 3
+		if r.rumble {
+			r.setRumble(value&0x8 != 0)
+			r.ramBank = uint32(value & 0x7)
+		} else {
+			r.ramBank = uint32(value & 0xF)
+		}
+	}
+}
+
+// WriteRAM writes data to the ram if it is enabled.
+func (r *MBC5) WriteRAM(address uint16, value byte) {
+	if r.ramEnabled && len(r.ram) > 0 {
+		r.ram[ramOffset(r.ram, r.ramBank, address)] = value
+	}
+}
+
+// setRumble turns the rumble motor on or off, notifying the callback if it
+// has changed.
+func (r *MBC5) setRumble(on bool) {
+	if on == r.rumbling {
+		return
+	}
+	r.rumbling = on
+	if r.onRumble != nil {
+		r.onRumble(on)
+	}
+}
+
+// hasRumble returns if the cart has a rumble motor.
+func (r *MBC5) hasRumble() bool {
+	return r.rumble
+}
+
+// setRumbleCallback sets the function called when the rumble motor changes.
+func (r *MBC5) setRumbleCallback(callback func(on bool)) {
+	r.onRumble = callback
+}
+
+// isRumbling returns if the rumble motor is currently on.
+func (r *MBC5) isRumbling() bool {
+	return r.rumbling
+}
+
+// GetSaveData returns the save data for this banking controller.
+func (r *MBC5) GetSaveData() []byte {
+	data := make([]byte, len(r.ram))
+	copy(data, r.ram)
+	return data
+}
+
+// LoadSaveData loads the save data into the cartridge.
+func (r *MBC5) LoadSaveData(data []byte) {
+	copy(r.ram, data)
+}
+
+// SyncState saves or loads the banks, RAM and rumble motor of the
+// controller.
+func (r *MBC5) SyncState(s *savestate.State) {
+	rumbling := r.rumbling
+	s.Sync(&r.romBank, r.ram, &r.ramBank, &r.ramEnabled, &rumbling)
+	r.setRumble(rumbling)
+}
+
+// currentROMBank returns the ROM bank mapped at 0x4000-0x7FFF.
+func (r *MBC5) currentROMBank() int {
+	return int(r.romBank % romBankCount(r.rom))
+}
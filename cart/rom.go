@@ -1,5 +1,7 @@
 package cart
 
+import "gameboy/savestate"
+
 type ROM struct {
 	rom []byte
 }
@@ -25,3 +27,7 @@ func (r *ROM) GetSaveData() []byte {
 // LoadSaveData loads the save data into the cartridge. As RAM is not supported
 // on this memory controller, this is a noop.
 func (r *ROM) LoadSaveData([]byte) {}
+
+// SyncState saves or loads the state of the controller. This controller
+// has no state besides the ROM.
+func (r *ROM) SyncState(s *savestate.State) {}
@@ -0,0 +1,263 @@
+package cart
+
+import (
+	"encoding/binary"
+	"gameboy/savestate"
+	"time"
+)
+
+const (
+	// Size of the RTC data appended to the save data, in the format used by
+	// VisualBoyAdvance, BGB and most other emulators.
+	rtcFooterSize = 48
+	// Size of the older version of the footer with a 32-bit timestamp.
+	rtcFooterSizeShort = 44
+)
+
+// The RTC registers, which are selected with the ram banks 0x08-0x0C.
+const (
+	rtcSeconds = iota
+	rtcMinutes
+	rtcHours
+	rtcDaysLow
+	rtcDaysHigh
+	rtcRegisterCount
+)
+
+// Bits in the days high register.
+const (
+	rtcDayBit8 = 0x01
+	rtcHalt    = 0x40
+	rtcCarry   = 0x80
+)
+
+// The bits which are stored in each of the RTC registers.
+var rtcMasks = [rtcRegisterCount]byte{0x3F, 0x3F, 0x1F, 0xFF, 0xC1}
+
+// rtc is the real time clock of an MBC3 cart. Rather than counting every
+// second the registers are brought up to date with the time which has
+// passed whenever they are latched or written.
+type rtc struct {
+	// The counting registers and the copy of them which the game reads.
+	regs    [rtcRegisterCount]byte
+	latched [rtcRegisterCount]byte
+
+	// The time up to which the registers have been counted.
+	updated time.Time
+	// The last value written to the latch register.
+	latchValue byte
+
+	now func() time.Time
+	// Whether now is a virtual clock rather than the time on the host.
+	virtual bool
+}
+
+func newRTC() *rtc {
+	r := &rtc{
+		latchValue: 0xFF,
+		now:        time.Now,
+	}
+	r.updated = r.now()
+	return r
+}
+
+// read returns the latched value of a register.
+func (r *rtc) read(reg byte) byte {
+	return r.latched[reg]
+}
+
+// write sets the value of a register. Writing the seconds also resets the
+// count towards the next second.
+func (r *rtc) write(reg byte, value byte) {
+	r.update()
+	if reg == rtcSeconds {
+		r.updated = r.now()
+	}
+	r.regs[reg] = value & rtcMasks[reg]
+}
+
+// latch copies the registers to the ones the game reads when 0x00 and then
+// 0x01 is written to the latch register.
+func (r *rtc) latch(value byte) {
+	if r.latchValue == 0x00 && value == 0x01 {
+		r.update()
+		r.latched = r.regs
+	}
+	r.latchValue = value
+}
+
+// update counts the whole seconds which have passed since the registers were
+// last updated. No time passes while the clock is halted.
+func (r *rtc) update() {
+	now := r.now()
+	elapsed := int64(now.Sub(r.updated) / time.Second)
+	if r.regs[rtcDaysHigh]&rtcHalt != 0 || elapsed < 0 {
+		r.updated = now
+		return
+	}
+	r.updated = r.updated.Add(time.Duration(elapsed) * time.Second)
+	r.advance(elapsed)
+}
+
+// advance moves the clock forward by a number of seconds.
+func (r *rtc) advance(seconds int64) {
+	// Registers which were set out of their range count up to their bit
+	// limit and wrap to 0 without carrying, so step through those a second
+	// at a time like the hardware does.
+	for seconds > 0 && !r.inRange() {
+		r.tick()
+		seconds--
+	}
+	if seconds == 0 {
+		return
+	}
+
+	total := int64(r.regs[rtcSeconds]) + int64(r.regs[rtcMinutes])*60 +
+		int64(r.regs[rtcHours])*3600 + int64(r.days())*86400 + seconds
+	r.regs[rtcSeconds] = byte(total % 60)
+	r.regs[rtcMinutes] = byte(total / 60 % 60)
+	r.regs[rtcHours] = byte(total / 3600 % 24)
+	days := total / 86400
+	if days > 0x1FF {
+		r.regs[rtcDaysHigh] |= rtcCarry
+	}
+	r.setDays(uint16(days & 0x1FF))
+}
+
+// inRange returns if the registers all hold values in their normal range.
+func (r *rtc) inRange() bool {
+	return r.regs[rtcSeconds] < 60 && r.regs[rtcMinutes] < 60 && r.regs[rtcHours] < 24
+}
+
+// tick moves the clock forward by a second.
+func (r *rtc) tick() {
+	if r.count(rtcSeconds, 60) && r.count(rtcMinutes, 60) && r.count(rtcHours, 24) {
+		days := r.days() + 1
+		if days > 0x1FF {
+			r.regs[rtcDaysHigh] |= rtcCarry
+			days = 0
+		}
+		r.setDays(days)
+	}
+}
+
+// count increments a register and returns if it rolled over into the next
+// register.
+func (r *rtc) count(reg byte, limit byte) bool {
+	r.regs[reg] = (r.regs[reg] + 1) & rtcMasks[reg]
+	if r.regs[reg] == limit {
+		r.regs[reg] = 0
+		return true
+	}
+	return false
+}
+
+// days returns the 9-bit day counter.
+func (r *rtc) days() uint16 {
+	return uint16(r.regs[rtcDaysHigh]&rtcDayBit8)<<8 | uint16(r.regs[rtcDaysLow])
+}
+
+func (r *rtc) setDays(days uint16) {
+	r.regs[rtcDaysLow] = byte(days)
+	r.regs[rtcDaysHigh] = r.regs[rtcDaysHigh]&^rtcDayBit8 | byte(days>>8)&rtcDayBit8
+}
+
+// saveData returns the footer which is appended to the save data. It holds
+// the registers and the latched registers as 32-bit values followed by the
+// timestamp the registers were counted up to. A virtual clock's time is
+// converted to the time on the host, so the save works with other emulators.
+func (r *rtc) saveData() []byte {
+	data := make([]byte, rtcFooterSize)
+	for i := 0; i < rtcRegisterCount; i++ {
+		binary.LittleEndian.PutUint32(data[i*4:], uint32(r.regs[i]))
+		binary.LittleEndian.PutUint32(data[20+i*4:], uint32(r.latched[i]))
+	}
+	updated := r.updated
+	if r.virtual {
+		updated = time.Now().Add(-r.now().Sub(r.updated))
+	}
+	binary.LittleEndian.PutUint64(data[40:], uint64(updated.Unix()))
+	return data
+}
+
+// loadData restores the registers from a save data footer and counts the
+// time which has passed since it was saved. With a virtual clock no time has
+// passed, so loading the same save always gives the same registers.
+func (r *rtc) loadData(data []byte) {
+	for i := 0; i < rtcRegisterCount; i++ {
+		r.regs[i] = byte(binary.LittleEndian.Uint32(data[i*4:])) & rtcMasks[i]
+		r.latched[i] = byte(binary.LittleEndian.Uint32(data[20+i*4:])) & rtcMasks[i]
+	}
+	if r.virtual {
+		r.updated = r.now()
+		return
+	}
+	var timestamp int64
+	if len(data) >= rtcFooterSize {
+		timestamp = int64(binary.LittleEndian.Uint64(data[40:]))
+	} else {
+		timestamp = int64(binary.LittleEndian.Uint32(data[40:]))
+	}
+	r.updated = time.Unix(timestamp, 0)
+	r.update()
+}
+
+// elapsed returns the time counted by the registers since day 0.
+func (r *rtc) elapsed() time.Duration {
+	r.update()
+	seconds := int64(r.regs[rtcSeconds]) + int64(r.regs[rtcMinutes])*60 +
+		int64(r.regs[rtcHours])*3600 + int64(r.days())*86400
+	return time.Duration(seconds) * time.Second
+}
+
+// set sets the registers to a time since day 0. The carry bit is set if it
+// is more days than the counter can hold.
+func (r *rtc) set(elapsed time.Duration) {
+	r.update()
+	r.updated = r.now()
+	r.regs[rtcSeconds] = 0
+	r.regs[rtcMinutes] = 0
+	r.regs[rtcHours] = 0
+	r.regs[rtcDaysHigh] &^= rtcCarry
+	r.setDays(0)
+	r.advance(int64(elapsed / time.Second))
+}
+
+// setVirtualClock changes the function used to get the current time to a
+// virtual clock. The time counted so far is kept, and counting carries on
+// from the new clock's time. Only the time on the host is counted up to the
+// change, as a virtual clock's time has nothing to do with the new one.
+func (r *rtc) setVirtualClock(now func() time.Time) {
+	if !r.virtual {
+		r.update()
+	}
+	r.now = now
+	r.virtual = true
+	r.updated = r.now()
+}
+
+// setHostClock changes back to counting the time on the host after using a
+// virtual clock. The time counted so far is kept.
+func (r *rtc) setHostClock() {
+	r.now = time.Now
+	r.virtual = false
+	r.updated = r.now()
+}
+
+// syncState saves or loads the registers of the clock.
+func (r *rtc) syncState(s *savestate.State) {
+	s.Sync(&r.regs, &r.latched, &r.updated, &r.latchValue)
+}
+
+// rtcFooterLength returns the size of the RTC footer at the end of some save
+// data, or 0 if it does not have one. The size of the cart RAM is always a
+// multiple of 2KB so the footer is what is left over.
+func rtcFooterLength(data []byte) int {
+	switch len(data) % 0x800 {
+	case rtcFooterSize:
+		return rtcFooterSize
+	case rtcFooterSizeShort:
+		return rtcFooterSizeShort
+	}
+	return 0
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"gameboy/disasm"
+	"gameboy/gb"
+	"gameboy/symbols"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+// debugCommand runs a ROM in a terminal debugger.
+func debugCommand(args []string) error {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	cgb := flags.Bool("cgb", false, "run the game in cgb mode if it supports it")
+	symFile := flags.String("sym", "", "symbol file for the labels, by default the rom's name with a .sym extension")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gameboy debug [-cgb] [-sym file] rom.gb")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected a single rom file")
+	}
+
+	syms, err := loadSymbols(*symFile, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	gameboy, err := gb.NewGameboy(flags.Arg(0), *cgb)
+	if err != nil {
+		return err
+	}
+	d := &debugger{gb: gameboy, d: gameboy.Debugger(), syms: syms}
+
+	// Ctrl+C stops the game instead of exiting while it is running.
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			d.d.Interrupt()
+		}
+	}()
+
+	if syms.Len() > 0 {
+		fmt.Printf("Loaded %d symbols\n", syms.Len())
+	}
+	fmt.Println(`Type "help" for a list of commands.`)
+	d.printRegisters()
+	return d.repl()
+}
+
+// debugger is the terminal interface of the debugger.
+type debugger struct {
+	gb   *gb.Gameboy
+	d    *gb.Debugger
+	syms *symbols.Table
+}
+
+type debugCmd struct {
+	names []string
+	usage string
+	help  string
+	run   func(d *debugger, args []string) error
+}
+
+var debugCmds []debugCmd
+
+func init() {
+	debugCmds = []debugCmd{
+		{[]string{"step", "s"}, "[n]", "run n instructions", (*debugger).step},
+		{[]string{"next", "n"}, "", "run an instruction, or the whole subroutine it calls", (*debugger).next},
+		{[]string{"finish", "out"}, "", "run until the current subroutine returns", (*debugger).finish},
+		{[]string{"continue", "c"}, "", "run until a breakpoint or watchpoint, Ctrl+C stops", (*debugger).cont},
+		{[]string{"frame", "f"}, "[n]", "run to the start of the vblank of the nth frame", (*debugger).frame},
+		{[]string{"scanline", "line"}, "ly", "run until the scanline ly starts", (*debugger).scanline},
+		{[]string{"break", "b"}, "[bank:]addr|label [if cond] | if cond", "add a breakpoint, such as \"03:4A10\", \"Main.loop\" or \"if A == 10\"", (*debugger).addBreakpoint},
+		{[]string{"watch", "w"}, "[r|w|x|rw|rwx] start[-end]", "add a watchpoint on reads, writes or execution", (*debugger).addWatchpoint},
+		{[]string{"delete", "d"}, "id", "remove a breakpoint or watchpoint", (*debugger).delete},
+		{[]string{"list", "l"}, "", "list the breakpoints and watchpoints", (*debugger).list},
+		{[]string{"regs", "r"}, "", "print the registers", (*debugger).regs},
+		{[]string{"mem", "x"}, "addr [length]", "print memory", (*debugger).mem},
+		{[]string{"disasm", "dis"}, "[addr] [n]", "disassemble n instructions from addr or PC", (*debugger).disasm},
+		{[]string{"stack"}, "[n]", "print the top n words of the stack", (*debugger).stack},
+		{[]string{"backtrace", "bt"}, "", "print the calls made since the debugger started which have not returned", (*debugger).backtrace},
+		{[]string{"help", "h"}, "", "print this help", (*debugger).help},
+		{[]string{"quit", "q"}, "", "exit the debugger", nil},
+	}
+}
+
+// repl reads and runs commands until quit or the end of the input. An empty
+// line repeats the last command.
+func (d *debugger) repl() error {
+	scanner := bufio.NewScanner(os.Stdin)
+	var last []string
+	for {
+		fmt.Print("(gb) ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return scanner.Err()
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			fields = last
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		last = fields
+
+		cmd := findDebugCmd(fields[0])
+		switch {
+		case cmd == nil:
+			fmt.Printf("Unknown command %q, type \"help\" for a list of commands.\n", fields[0])
+		case cmd.run == nil:
+			return nil
+		default:
+			if err := cmd.run(d, fields[1:]); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
+
+func findDebugCmd(name string) *debugCmd {
+	for i, cmd := range debugCmds {
+		for _, n := range cmd.names {
+			if n == name {
+				return &debugCmds[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (d *debugger) help([]string) error {
+	for _, cmd := range debugCmds {
+		fmt.Printf("  %-34s %s\n", strings.Join(cmd.names, ", ")+" "+cmd.usage, cmd.help)
+	}
+	return nil
+}
+
+// stopped prints where the game stopped.
+func (d *debugger) stopped(stop gb.Stop) {
+	if stop.Reason != gb.StopDone {
+		fmt.Println(stop)
+	}
+	d.printRegisters()
+}
+
+func (d *debugger) step(args []string) error {
+	n, err := countArg(args, 1)
+	if err != nil {
+		return err
+	}
+	stop := gb.Stop{}
+	for i := 0; i < n && stop.Reason == gb.StopDone; i++ {
+		stop = d.d.Step()
+	}
+	d.stopped(stop)
+	return nil
+}
+
+func (d *debugger) next([]string) error {
+	d.stopped(d.d.StepOver())
+	return nil
+}
+
+func (d *debugger) finish([]string) error {
+	d.stopped(d.d.StepOut())
+	return nil
+}
+
+func (d *debugger) cont([]string) error {
+	d.stopped(d.d.Continue())
+	return nil
+}
+
+func (d *debugger) frame(args []string) error {
+	n, err := countArg(args, 1)
+	if err != nil {
+		return err
+	}
+	d.stopped(d.d.RunFrames(n))
+	return nil
+}
+
+func (d *debugger) scanline(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: scanline ly")
+	}
+	line, err := strconv.Atoi(args[0])
+	if err != nil || line < 0 || line > 153 {
+		return fmt.Errorf("invalid scanline %q, expected 0-153", args[0])
+	}
+	d.stopped(d.d.RunToScanline(line))
+	return nil
+}
+
+func (d *debugger) addBreakpoint(args []string) error {
+	var loc *gb.Location
+	if len(args) > 0 && args[0] != "if" {
+		l, err := d.parseLocation(args[0])
+		if err != nil {
+			return err
+		}
+		loc = &l
+		args = args[1:]
+	}
+	var cond *gb.Condition
+	if len(args) > 0 {
+		if args[0] != "if" || len(args) == 1 {
+			return errors.New("usage: break [bank:]addr [if cond] | if cond")
+		}
+		c, err := gb.ParseCondition(strings.Join(args[1:], " "))
+		if err != nil {
+			return err
+		}
+		cond = c
+	}
+	id, err := d.d.AddBreakpoint(loc, cond)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Breakpoint %d added\n", id)
+	return nil
+}
+
+func (d *debugger) addWatchpoint(args []string) error {
+	kind := gb.WatchWrite
+	if len(args) == 2 {
+		kind = 0
+		for _, c := range args[0] {
+			switch c {
+			case 'r':
+				kind |= gb.WatchRead
+			case 'w':
+				kind |= gb.WatchWrite
+			case 'x':
+				kind |= gb.WatchExecute
+			default:
+				return fmt.Errorf("invalid watchpoint kind %q, expected r, w or x", args[0])
+			}
+		}
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return errors.New("usage: watch [r|w|x|rw|rwx] start[-end]")
+	}
+	start, end, err := d.parseRange(args[0])
+	if err != nil {
+		return err
+	}
+	id, err := d.d.AddWatchpoint(start, end, kind)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Watchpoint %d added\n", id)
+	return nil
+}
+
+func (d *debugger) delete(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: delete id")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid id %q", args[0])
+	}
+	return d.d.Delete(id)
+}
+
+func (d *debugger) list([]string) error {
+	breakpoints, watchpoints := d.d.Breakpoints(), d.d.Watchpoints()
+	if len(breakpoints) == 0 && len(watchpoints) == 0 {
+		fmt.Println("No breakpoints or watchpoints")
+	}
+	for _, b := range breakpoints {
+		label := ""
+		if b.Location != nil {
+			label = d.label(b.Location.Bank, b.Location.Address)
+		}
+		fmt.Printf("%3d  breakpoint %v%s  (%d hits)\n", b.ID, b, label, b.Hits)
+	}
+	for _, w := range watchpoints {
+		fmt.Printf("%3d  watchpoint %v  (%d hits)\n", w.ID, w, w.Hits)
+	}
+	return nil
+}
+
+func (d *debugger) regs([]string) error {
+	d.printRegisters()
+	return nil
+}
+
+// printRegisters prints the registers, flags and the next instruction.
+func (d *debugger) printRegisters() {
+	cpu := d.gb.CPU
+	flags := []byte("----")
+	for i, name := range "ZNHC" {
+		if cpu.F&(0x80>>i) != 0 {
+			flags[i] = byte(name)
+		}
+	}
+	fmt.Printf("AF=%02X%02X BC=%02X%02X DE=%02X%02X HL=%02X%02X SP=%04X PC=%04X  %s  IME=%d  LY=%02X  ROM=%02X\n",
+		cpu.A, cpu.F, cpu.B, cpu.C, cpu.D, cpu.E, cpu.H, cpu.L, cpu.SP, cpu.PC, flags,
+		boolDigit(cpu.IME), d.gb.Memory.ReadByte(0xFF44), d.gb.Memory.Cart.ROMBank())
+
+	if name := d.name(cpu.PC); name != "" {
+		fmt.Printf("%s:\n", name)
+	}
+	fmt.Println(d.formatInstruction(cpu.PC))
+}
+
+// formatInstruction disassembles the instruction at an address.
+func (d *debugger) formatInstruction(address uint16) string {
+	inst := disasm.Decode(d.gb.Memory.ReadByte, address)
+	return formatInstruction(d.gb.Bank(address), inst, d.name)
+}
+
+// name returns the nearest symbol to an address in the banks which are
+// currently mapped, such as "Main.loop+$3", or "" if there is none.
+func (d *debugger) name(address uint16) string {
+	return d.syms.Describe(d.gb.Bank(address), address)
+}
+
+// label returns the nearest symbol to an address in a bank, or in the
+// current bank for AnyBank, in angle brackets after a space.
+func (d *debugger) label(bank int, address uint16) string {
+	if bank == gb.AnyBank {
+		bank = d.gb.Bank(address)
+	}
+	if name := d.syms.Describe(bank, address); name != "" {
+		return " <" + name + ">"
+	}
+	return ""
+}
+
+func (d *debugger) disasm(args []string) error {
+	address := d.gb.CPU.PC
+	if len(args) > 0 {
+		a, err := d.parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		address = a
+		args = args[1:]
+	}
+	n, err := countArg(args, 10)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		printLabel(d.syms, d.gb.Bank(address), address)
+		fmt.Println(d.formatInstruction(address))
+		address += uint16(disasm.Decode(d.gb.Memory.ReadByte, address).Length())
+	}
+	return nil
+}
+
+func (d *debugger) mem(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: mem addr [length]")
+	}
+	start, err := d.parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+	length := 0x40
+	if len(args) == 2 {
+		if length, err = countArg(args[1:], 0); err != nil {
+			return err
+		}
+	}
+	for row := 0; row < length; row += 16 {
+		address := start + uint16(row)
+		fmt.Printf("%04X ", address)
+		for i := 0; i < 16 && row+i < length; i++ {
+			fmt.Printf(" %02X", d.gb.Memory.ReadByte(address+uint16(i)))
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func (d *debugger) stack(args []string) error {
+	n, err := countArg(args, 8)
+	if err != nil {
+		return err
+	}
+	sp := d.gb.CPU.SP
+	for i := 0; i < n; i++ {
+		address := sp + uint16(i*2)
+		word := d.gb.Memory.ReadWord(address)
+		fmt.Printf("%04X  %04X%s\n", address, word, d.label(gb.AnyBank, word))
+		if address >= 0xFFFC {
+			break
+		}
+	}
+	return nil
+}
+
+func (d *debugger) backtrace([]string) error {
+	pc := d.gb.CPU.PC
+	fmt.Printf("#0  %02X:%04X%s\n", d.gb.Bank(pc), pc, d.label(d.gb.Bank(pc), pc))
+	for i, f := range d.d.CallStack() {
+		called := "called"
+		if f.Interrupt {
+			called = "interrupted by"
+		}
+		fmt.Printf("#%d  %02X:%04X%s  %s %04X%s\n", i+1, f.CallerBank, f.Caller, d.label(f.CallerBank, f.Caller),
+			called, f.Target, d.label(f.TargetBank, f.Target))
+	}
+	return nil
+}
+
+// countArg parses an optional count argument, which is def if not given.
+func countArg(args []string, def int) (int, error) {
+	if len(args) == 0 {
+		return def, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid count %q", args[0])
+	}
+	return n, nil
+}
+
+// parseLocation parses a label or a hexadecimal address with an optional
+// bank. A label in a banked area of memory is only matched in its bank.
+func (d *debugger) parseLocation(s string) (gb.Location, error) {
+	sym, ok := d.syms.Lookup(s)
+	if !ok {
+		return gb.ParseLocation(s)
+	}
+	loc := gb.Location{Bank: sym.Bank, Address: sym.Address}
+	if (sym.Address >= 0xA000 && sym.Address < 0xC000) || sym.Address >= 0xE000 {
+		// The bank of the cart RAM is not known
+		loc.Bank = gb.AnyBank
+	}
+	return loc, nil
+}
+
+// parseAddress parses a label or a hexadecimal address.
+func (d *debugger) parseAddress(s string) (uint16, error) {
+	if sym, ok := d.syms.Lookup(s); ok {
+		return sym.Address, nil
+	}
+	loc, err := gb.ParseLocation(s)
+	if err != nil {
+		return 0, err
+	}
+	if loc.Bank != gb.AnyBank {
+		return 0, fmt.Errorf("unexpected bank in %q", s)
+	}
+	return loc.Address, nil
+}
+
+// parseRange parses an address or a range such as "C000-C0FF".
+func (d *debugger) parseRange(s string) (uint16, uint16, error) {
+	start, end, ok := strings.Cut(s, "-")
+	first, err := d.parseAddress(start)
+	if err != nil || !ok {
+		return first, first, err
+	}
+	last, err := d.parseAddress(end)
+	return first, last, err
+}
+
+func boolDigit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
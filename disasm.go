@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gameboy/disasm"
+	"gameboy/symbols"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// disasmCommand prints the disassembly of part of a ROM.
+func disasmCommand(args []string) error {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	bank := flags.Int("bank", -1, "ROM bank to disassemble, by default 0 below 0x4000 and 1 above")
+	from := flags.String("from", "0x0100", "address to start from")
+	count := flags.Int("count", 64, "number of instructions to disassemble")
+	symFile := flags.String("sym", "", "symbol file for the labels, by default the rom's name with a .sym extension")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gameboy disasm [-bank n] [-from addr|label] [-count n] [-sym file] rom.gb")
+		fmt.Fprintln(flags.Output(), "Conditional instructions show the cycles when not taken/taken.")
+		flags.PrintDefaults()
+	}
+	// The flags can come before or after the rom, so parse the ones after
+	// it once it has been taken.
+	flags.Parse(args)
+	romFile := flags.Arg(0)
+	if flags.NArg() > 0 {
+		flags.Parse(flags.Args()[1:])
+	}
+	if romFile == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return errors.New("expected a single rom file")
+	}
+
+	rom, err := os.ReadFile(romFile)
+	if err != nil {
+		return err
+	}
+	syms, err := loadSymbols(*symFile, romFile)
+	if err != nil {
+		return err
+	}
+	start, err := strconv.ParseUint(*from, 0, 16)
+	if sym, ok := syms.Lookup(*from); ok {
+		start, err = uint64(sym.Address), nil
+		if *bank == -1 && sym.Address >= 0x4000 {
+			*bank = sym.Bank
+		}
+	}
+	if err != nil || start >= 0x8000 {
+		return fmt.Errorf("invalid address %q, expected an address in ROM (0x0000-0x7FFF)", *from)
+	}
+	if *bank == -1 {
+		*bank = 0
+		if start >= 0x4000 {
+			*bank = 1
+		}
+	}
+	banks := (len(rom) + 0x3FFF) / 0x4000
+	switch {
+	case *bank < 0 || *bank >= banks:
+		return fmt.Errorf("invalid bank %d, the rom has %d banks", *bank, banks)
+	case start < 0x4000 && *bank != 0:
+		return errors.New("0x0000-0x3FFF is always bank 0")
+	case start >= 0x4000 && *bank == 0:
+		return errors.New("bank 0 is only mapped at 0x0000-0x3FFF")
+	}
+
+	// bankAt returns the bank mapped at an address. Disassembling bank 0
+	// carries on into bank 1 at 0x4000, as that is the bank mapped there
+	// at power on.
+	bankAt := func(address uint16) int {
+		switch {
+		case address < 0x4000:
+			return 0
+		case *bank == 0:
+			return 1
+		}
+		return *bank
+	}
+	read := func(address uint16) byte {
+		offset := bankAt(address)*0x4000 + int(address&0x3FFF)
+		if address >= 0x8000 || offset >= len(rom) {
+			return 0xFF
+		}
+		return rom[offset]
+	}
+	// Addresses outside of the rom could be in any bank.
+	name := func(address uint16) string {
+		if address >= 0x8000 {
+			return syms.Describe(symbols.AnyBank, address)
+		}
+		return syms.Describe(bankAt(address), address)
+	}
+	address := uint16(start)
+	for i := 0; i < *count && address < 0x8000; i++ {
+		printLabel(syms, bankAt(address), address)
+		inst := disasm.Decode(read, address)
+		fmt.Println(formatInstruction(bankAt(address), inst, name))
+		address += uint16(inst.Length())
+	}
+	return nil
+}
+
+// loadSymbols loads a symbol file, or the one next to the rom if filename is
+// empty. The table is nil if there are no symbols.
+func loadSymbols(filename, rom string) (*symbols.Table, error) {
+	if filename != "" {
+		return symbols.Load(filename)
+	}
+	return symbols.ForROM(rom)
+}
+
+// printLabel prints the name of the symbol at an address as a label.
+func printLabel(syms *symbols.Table, bank int, address uint16) {
+	if sym, ok := syms.At(bank, address); ok {
+		fmt.Printf("%s:\n", sym.Name)
+	}
+}
+
+// formatInstruction formats a line of disassembly with the address, bytes
+// and cycles of an instruction. The target of the instruction is replaced by
+// the name returned by name if it is not nil.
+func formatInstruction(bank int, inst disasm.Instruction, name func(address uint16) string) string {
+	hex := make([]string, len(inst.Bytes))
+	for i, b := range inst.Bytes {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	cycles := strconv.Itoa(inst.Cycles)
+	if inst.BranchCycles != 0 {
+		cycles += "/" + strconv.Itoa(inst.BranchCycles)
+	}
+	text := inst.Text
+	if name != nil {
+		text = inst.Symbolize(name)
+	}
+	return fmt.Sprintf("%02X:%04X  %-9s %-20s ; %s", bank, inst.Address, strings.Join(hex, " "), text, cycles)
+}
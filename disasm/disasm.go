@@ -0,0 +1,442 @@
+// Package disasm decodes SM83 machine code into RGBDS assembly.
+package disasm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// opcode describes an instruction. The format is the instruction in RGBDS
+// syntax with placeholders for its operand: n8 and n16 are immediate values,
+// a8 is an address in 0xFF00-0xFFFF, a16 is an address, r8 is a relative jump
+// and e8 is a signed offset.
+type opcode struct {
+	format string
+	// Number of cycles the instruction takes, or when a conditional
+	// instruction does not branch.
+	cycles int
+	// Number of cycles a conditional instruction takes when it branches, or
+	// 0 for the other instructions.
+	branchCycles int
+}
+
+// opcodes are the instructions without the 0xCB prefix. The opcodes which do
+// not exist on the SM83 have an empty format.
+var opcodes = [256]opcode{
+	0x00: {"nop", 4, 0},
+	0x01: {"ld bc, n16", 12, 0},
+	0x02: {"ld [bc], a", 8, 0},
+	0x03: {"inc bc", 8, 0},
+	0x04: {"inc b", 4, 0},
+	0x05: {"dec b", 4, 0},
+	0x06: {"ld b, n8", 8, 0},
+	0x07: {"rlca", 4, 0},
+	0x08: {"ld [a16], sp", 20, 0},
+	0x09: {"add hl, bc", 8, 0},
+	0x0A: {"ld a, [bc]", 8, 0},
+	0x0B: {"dec bc", 8, 0},
+	0x0C: {"inc c", 4, 0},
+	0x0D: {"dec c", 4, 0},
+	0x0E: {"ld c, n8", 8, 0},
+	0x0F: {"rrca", 4, 0},
+	0x10: {"stop", 4, 0},
+	0x11: {"ld de, n16", 12, 0},
+	0x12: {"ld [de], a", 8, 0},
+	0x13: {"inc de", 8, 0},
+	0x14: {"inc d", 4, 0},
+	0x15: {"dec d", 4, 0},
+	0x16: {"ld d, n8", 8, 0},
+	0x17: {"rla", 4, 0},
+	0x18: {"jr r8", 12, 0},
+	0x19: {"add hl, de", 8, 0},
+	0x1A: {"ld a, [de]", 8, 0},
+	0x1B: {"dec de", 8, 0},
+	0x1C: {"inc e", 4, 0},
+	0x1D: {"dec e", 4, 0},
+	0x1E: {"ld e, n8", 8, 0},
+	0x1F: {"rra", 4, 0},
+	0x20: {"jr nz, r8", 8, 12},
+	0x21: {"ld hl, n16", 12, 0},
+	0x22: {"ld [hli], a", 8, 0},
+	0x23: {"inc hl", 8, 0},
+	0x24: {"inc h", 4, 0},
+	0x25: {"dec h", 4, 0},
+	0x26: {"ld h, n8", 8, 0},
+	0x27: {"daa", 4, 0},
+	0x28: {"jr z, r8", 8, 12},
+	0x29: {"add hl, hl", 8, 0},
+	0x2A: {"ld a, [hli]", 8, 0},
+	0x2B: {"dec hl", 8, 0},
+	0x2C: {"inc l", 4, 0},
+	0x2D: {"dec l", 4, 0},
+	0x2E: {"ld l, n8", 8, 0},
+	0x2F: {"cpl", 4, 0},
+	0x30: {"jr nc, r8", 8, 12},
+	0x31: {"ld sp, n16", 12, 0},
+	0x32: {"ld [hld], a", 8, 0},
+	0x33: {"inc sp", 8, 0},
+	0x34: {"inc [hl]", 12, 0},
+	0x35: {"dec [hl]", 12, 0},
+	0x36: {"ld [hl], n8", 12, 0},
+	0x37: {"scf", 4, 0},
+	0x38: {"jr c, r8", 8, 12},
+	0x39: {"add hl, sp", 8, 0},
+	0x3A: {"ld a, [hld]", 8, 0},
+	0x3B: {"dec sp", 8, 0},
+	0x3C: {"inc a", 4, 0},
+	0x3D: {"dec a", 4, 0},
+	0x3E: {"ld a, n8", 8, 0},
+	0x3F: {"ccf", 4, 0},
+	0x40: {"ld b, b", 4, 0},
+	0x41: {"ld b, c", 4, 0},
+	0x42: {"ld b, d", 4, 0},
+	0x43: {"ld b, e", 4, 0},
+	0x44: {"ld b, h", 4, 0},
+	0x45: {"ld b, l", 4, 0},
+	0x46: {"ld b, [hl]", 8, 0},
+	0x47: {"ld b, a", 4, 0},
+	0x48: {"ld c, b", 4, 0},
+	0x49: {"ld c, c", 4, 0},
+	0x4A: {"ld c, d", 4, 0},
+	0x4B: {"ld c, e", 4, 0},
+	0x4C: {"ld c, h", 4, 0},
+	0x4D: {"ld c, l", 4, 0},
+	0x4E: {"ld c, [hl]", 8, 0},
+	0x4F: {"ld c, a", 4, 0},
+	0x50: {"ld d, b", 4, 0},
+	0x51: {"ld d, c", 4, 0},
+	0x52: {"ld d, d", 4, 0},
+	0x53: {"ld d, e", 4, 0},
+	0x54: {"ld d, h", 4, 0},
+	0x55: {"ld d, l", 4, 0},
+	0x56: {"ld d, [hl]", 8, 0},
+	0x57: {"ld d, a", 4, 0},
+	0x58: {"ld e, b", 4, 0},
+	0x59: {"ld e, c", 4, 0},
+	0x5A: {"ld e, d", 4, 0},
+	0x5B: {"ld e, e", 4, 0},
+	0x5C: {"ld e, h", 4, 0},
+	0x5D: {"ld e, l", 4, 0},
+	0x5E: {"ld e, [hl]", 8, 0},
+	0x5F: {"ld e, a", 4, 0},
+	0x60: {"ld h, b", 4, 0},
+	0x61: {"ld h, c", 4, 0},
+	0x62: {"ld h, d", 4, 0},
+	0x63: {"ld h, e", 4, 0},
+	0x64: {"ld h, h", 4, 0},
+	0x65: {"ld h, l", 4, 0},
+	0x66: {"ld h, [hl]", 8, 0},
+	0x67: {"ld h, a", 4, 0},
+	0x68: {"ld l, b", 4, 0},
+	0x69: {"ld l, c", 4, 0},
+	0x6A: {"ld l, d", 4, 0},
+	0x6B: {"ld l, e", 4, 0},
+	0x6C: {"ld l, h", 4, 0},
+	0x6D: {"ld l, l", 4, 0},
+	0x6E: {"ld l, [hl]", 8, 0},
+	0x6F: {"ld l, a", 4, 0},
+	0x70: {"ld [hl], b", 8, 0},
+	0x71: {"ld [hl], c", 8, 0},
+	0x72: {"ld [hl], d", 8, 0},
+	0x73: {"ld [hl], e", 8, 0},
+	0x74: {"ld [hl], h", 8, 0},
+	0x75: {"ld [hl], l", 8, 0},
+	0x76: {"halt", 4, 0},
+	0x77: {"ld [hl], a", 8, 0},
+	0x78: {"ld a, b", 4, 0},
+	0x79: {"ld a, c", 4, 0},
+	0x7A: {"ld a, d", 4, 0},
+	0x7B: {"ld a, e", 4, 0},
+	0x7C: {"ld a, h", 4, 0},
+	0x7D: {"ld a, l", 4, 0},
+	0x7E: {"ld a, [hl]", 8, 0},
+	0x7F: {"ld a, a", 4, 0},
+	0x80: {"add a, b", 4, 0},
+	0x81: {"add a, c", 4, 0},
+	0x82: {"add a, d", 4, 0},
+	0x83: {"add a, e", 4, 0},
+	0x84: {"add a, h", 4, 0},
+	0x85: {"add a, l", 4, 0},
+	0x86: {"add a, [hl]", 8, 0},
+	0x87: {"add a, a", 4, 0},
+	0x88: {"adc a, b", 4, 0},
+	0x89: {"adc a, c", 4, 0},
+	0x8A: {"adc a, d", 4, 0},
+	0x8B: {"adc a, e", 4, 0},
+	0x8C: {"adc a, h", 4, 0},
+	0x8D: {"adc a, l", 4, 0},
+	0x8E: {"adc a, [hl]", 8, 0},
+	0x8F: {"adc a, a", 4, 0},
+	0x90: {"sub a, b", 4, 0},
+	0x91: {"sub a, c", 4, 0},
+	0x92: {"sub a, d", 4, 0},
+	0x93: {"sub a, e", 4, 0},
+	0x94: {"sub a, h", 4, 0},
+	0x95: {"sub a, l", 4, 0},
+	0x96: {"sub a, [hl]", 8, 0},
+	0x97: {"sub a, a", 4, 0},
+	0x98: {"sbc a, b", 4, 0},
+	0x99: {"sbc a, c", 4, 0},
+	0x9A: {"sbc a, d", 4, 0},
+	0x9B: {"sbc a, e", 4, 0},
+	0x9C: {"sbc a, h", 4, 0},
+	0x9D: {"sbc a, l", 4, 0},
+	0x9E: {"sbc a, [hl]", 8, 0},
+	0x9F: {"sbc a, a", 4, 0},
+	0xA0: {"and a, b", 4, 0},
+	0xA1: {"and a, c", 4, 0},
+	0xA2: {"and a, d", 4, 0},
+	0xA3: {"and a, e", 4, 0},
+	0xA4: {"and a, h", 4, 0},
+	0xA5: {"and a, l", 4, 0},
+	0xA6: {"and a, [hl]", 8, 0},
+	0xA7: {"and a, a", 4, 0},
+	0xA8: {"xor a, b", 4, 0},
+	0xA9: {"xor a, c", 4, 0},
+	0xAA: {"xor a, d", 4, 0},
+	0xAB: {"xor a, e", 4, 0},
+	0xAC: {"xor a, h", 4, 0},
+	0xAD: {"xor a, l", 4, 0},
+	0xAE: {"xor a, [hl]", 8, 0},
+	0xAF: {"xor a, a", 4, 0},
+	0xB0: {"or a, b", 4, 0},
+	0xB1: {"or a, c", 4, 0},
+	0xB2: {"or a, d", 4, 0},
+	0xB3: {"or a, e", 4, 0},
+	0xB4: {"or a, h", 4, 0},
+	0xB5: {"or a, l", 4, 0},
+	0xB6: {"or a, [hl]", 8, 0},
+	0xB7: {"or a, a", 4, 0},
+	0xB8: {"cp a, b", 4, 0},
+	0xB9: {"cp a, c", 4, 0},
+	0xBA: {"cp a, d", 4, 0},
+	0xBB: {"cp a, e", 4, 0},
+	0xBC: {"cp a, h", 4, 0},
+	0xBD: {"cp a, l", 4, 0},
+	0xBE: {"cp a, [hl]", 8, 0},
+	0xBF: {"cp a, a", 4, 0},
+	0xC0: {"ret nz", 8, 20},
+	0xC1: {"pop bc", 12, 0},
+	0xC2: {"jp nz, a16", 12, 16},
+	0xC3: {"jp a16", 16, 0},
+	0xC4: {"call nz, a16", 12, 24},
+	0xC5: {"push bc", 16, 0},
+	0xC6: {"add a, n8", 8, 0},
+	0xC7: {"rst $00", 16, 0},
+	0xC8: {"ret z", 8, 20},
+	0xC9: {"ret", 16, 0},
+	0xCA: {"jp z, a16", 12, 16},
+	0xCB: {"prefix", 4, 0},
+	0xCC: {"call z, a16", 12, 24},
+	0xCD: {"call a16", 24, 0},
+	0xCE: {"adc a, n8", 8, 0},
+	0xCF: {"rst $08", 16, 0},
+	0xD0: {"ret nc", 8, 20},
+	0xD1: {"pop de", 12, 0},
+	0xD2: {"jp nc, a16", 12, 16},
+	0xD3: {"", 4, 0},
+	0xD4: {"call nc, a16", 12, 24},
+	0xD5: {"push de", 16, 0},
+	0xD6: {"sub a, n8", 8, 0},
+	0xD7: {"rst $10", 16, 0},
+	0xD8: {"ret c", 8, 20},
+	0xD9: {"reti", 16, 0},
+	0xDA: {"jp c, a16", 12, 16},
+	0xDB: {"", 4, 0},
+	0xDC: {"call c, a16", 12, 24},
+	0xDD: {"", 4, 0},
+	0xDE: {"sbc a, n8", 8, 0},
+	0xDF: {"rst $18", 16, 0},
+	0xE0: {"ldh [a8], a", 12, 0},
+	0xE1: {"pop hl", 12, 0},
+	0xE2: {"ldh [c], a", 8, 0},
+	0xE3: {"", 4, 0},
+	0xE4: {"", 4, 0},
+	0xE5: {"push hl", 16, 0},
+	0xE6: {"and a, n8", 8, 0},
+	0xE7: {"rst $20", 16, 0},
+	0xE8: {"add sp, e8", 16, 0},
+	0xE9: {"jp hl", 4, 0},
+	0xEA: {"ld [a16], a", 16, 0},
+	0xEB: {"", 4, 0},
+	0xEC: {"", 4, 0},
+	0xED: {"", 4, 0},
+	0xEE: {"xor a, n8", 8, 0},
+	0xEF: {"rst $28", 16, 0},
+	0xF0: {"ldh a, [a8]", 12, 0},
+	0xF1: {"pop af", 12, 0},
+	0xF2: {"ldh a, [c]", 8, 0},
+	0xF3: {"di", 4, 0},
+	0xF4: {"", 4, 0},
+	0xF5: {"push af", 16, 0},
+	0xF6: {"or a, n8", 8, 0},
+	0xF7: {"rst $30", 16, 0},
+	0xF8: {"ld hl, sp+e8", 12, 0},
+	0xF9: {"ld sp, hl", 8, 0},
+	0xFA: {"ld a, [a16]", 16, 0},
+	0xFB: {"ei", 4, 0},
+	0xFC: {"", 4, 0},
+	0xFD: {"", 4, 0},
+	0xFE: {"cp a, n8", 8, 0},
+	0xFF: {"rst $38", 16, 0},
+}
+
+var (
+	cbOperations = [8]string{"rlc", "rrc", "rl", "rr", "sla", "sra", "swap", "srl"}
+	cbRegisters  = [8]string{"b", "c", "d", "e", "h", "l", "[hl]", "a"}
+)
+
+// cbOpcode returns the instruction for an opcode after the 0xCB prefix. They
+// take 8 cycles, or 16 on [hl] except for bit which only reads it.
+func cbOpcode(op byte) opcode {
+	register := cbRegisters[op&0x7]
+	bit := (op >> 3) & 0x7
+	var format string
+	switch op >> 6 {
+	case 0:
+		format = cbOperations[bit] + " " + register
+	case 1:
+		format = fmt.Sprintf("bit %d, %s", bit, register)
+	case 2:
+		format = fmt.Sprintf("res %d, %s", bit, register)
+	default:
+		format = fmt.Sprintf("set %d, %s", bit, register)
+	}
+
+	cycles := 8
+	if register == "[hl]" {
+		cycles = 16
+		if op>>6 == 1 {
+			cycles = 12
+		}
+	}
+	return opcode{format: format, cycles: cycles}
+}
+
+// Instruction is a decoded instruction.
+type Instruction struct {
+	Address uint16
+	// The bytes of the instruction, including the opcode.
+	Bytes []byte
+	// The instruction in RGBDS syntax, such as "ld a, [$C000]".
+	Text string
+	// Number of cycles the instruction takes, or when a conditional
+	// instruction does not branch.
+	Cycles int
+	// Number of cycles a conditional instruction takes when it branches, or
+	// 0 for the other instructions.
+	BranchCycles int
+	// The address the instruction refers to, which is the target of jumps
+	// and calls and the address of loads, if HasTarget is set.
+	Target    uint16
+	HasTarget bool
+	// The text of the target in Text, such as "$C000" or "$38" for rst,
+	// which is replaced by Symbolize.
+	Operand string
+}
+
+// Length returns the number of bytes in the instruction.
+func (i Instruction) Length() int {
+	return len(i.Bytes)
+}
+
+func (i Instruction) String() string {
+	return i.Text
+}
+
+// Symbolize returns the text of the instruction with its target replaced by
+// the name returned by name, such as "call Main.loop". The text is unchanged
+// if there is no target or name returns "".
+func (i Instruction) Symbolize(name func(target uint16) string) string {
+	if !i.HasTarget {
+		return i.Text
+	}
+	label := name(i.Target)
+	if label == "" {
+		return i.Text
+	}
+	return strings.Replace(i.Text, i.Operand, label, 1)
+}
+
+// Decode decodes the instruction at an address, reading its bytes with read.
+func Decode(read func(address uint16) byte, address uint16) Instruction {
+	op := read(address)
+	if op == 0xCB {
+		cb := cbOpcode(read(address + 1))
+		return Instruction{
+			Address: address,
+			Bytes:   []byte{op, read(address + 1)},
+			Text:    cb.format,
+			Cycles:  cb.cycles,
+		}
+	}
+
+	info := opcodes[op]
+	inst := Instruction{
+		Address:      address,
+		Bytes:        []byte{op},
+		Cycles:       info.cycles,
+		BranchCycles: info.branchCycles,
+	}
+	if info.format == "" {
+		inst.Text = fmt.Sprintf("db $%02X", op)
+		return inst
+	}
+	if op == 0x10 {
+		// STOP is followed by a byte which is ignored
+		inst.Bytes = append(inst.Bytes, read(address+1))
+		inst.Text = info.format
+		return inst
+	}
+
+	placeholder, size := operand(info.format)
+	for i := 1; i <= size; i++ {
+		inst.Bytes = append(inst.Bytes, read(address+uint16(i)))
+	}
+	var value string
+	switch placeholder {
+	case "n8":
+		value = fmt.Sprintf("$%02X", inst.Bytes[1])
+	case "n16":
+		value = fmt.Sprintf("$%04X", uint16(inst.Bytes[1])|uint16(inst.Bytes[2])<<8)
+	case "a8":
+		inst.Target, inst.HasTarget = 0xFF00|uint16(inst.Bytes[1]), true
+		value = fmt.Sprintf("$%04X", inst.Target)
+	case "a16":
+		inst.Target, inst.HasTarget = uint16(inst.Bytes[1])|uint16(inst.Bytes[2])<<8, true
+		value = fmt.Sprintf("$%04X", inst.Target)
+	case "r8":
+		next := address + uint16(len(inst.Bytes))
+		inst.Target, inst.HasTarget = next+uint16(int8(inst.Bytes[1])), true
+		value = fmt.Sprintf("$%04X", inst.Target)
+	case "e8":
+		offset := int8(inst.Bytes[1])
+		if offset < 0 && strings.Contains(info.format, "+e8") {
+			placeholder = "+e8"
+		}
+		value = fmt.Sprintf("%d", offset)
+	}
+	inst.Text = strings.Replace(info.format, placeholder, value, 1)
+	if inst.HasTarget {
+		inst.Operand = value
+	}
+	if strings.HasPrefix(inst.Text, "rst ") {
+		inst.Target, inst.HasTarget = uint16(op&0x38), true
+		inst.Operand = strings.TrimPrefix(inst.Text, "rst ")
+	}
+	return inst
+}
+
+// operand returns the placeholder in a format and the number of bytes of its
+// operand.
+func operand(format string) (string, int) {
+	for _, p := range []string{"n16", "a16", "n8", "a8", "r8", "e8"} {
+		if strings.Contains(format, p) {
+			if strings.HasSuffix(p, "16") {
+				return p, 2
+			}
+			return p, 1
+		}
+	}
+	return "", 0
+}
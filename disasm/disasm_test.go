@@ -0,0 +1,91 @@
+package disasm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		address      uint16
+		code         []byte
+		text         string
+		length       int
+		cycles       int
+		branchCycles int
+	}{
+		{0x0100, []byte{0x00}, "nop", 1, 4, 0},
+		{0x0100, []byte{0x01, 0x34, 0x12}, "ld bc, $1234", 3, 12, 0},
+		{0x0100, []byte{0x06, 0xAB}, "ld b, $AB", 2, 8, 0},
+		{0x0100, []byte{0x08, 0x00, 0xC0}, "ld [$C000], sp", 3, 20, 0},
+		{0x0100, []byte{0x10, 0x00}, "stop", 2, 4, 0},
+		{0x0100, []byte{0x18, 0x05}, "jr $0107", 2, 12, 0},
+		{0x0100, []byte{0x18, 0xFE}, "jr $0100", 2, 12, 0},
+		{0x0100, []byte{0x20, 0x80}, "jr nz, $0082", 2, 8, 12},
+		{0x0100, []byte{0x36, 0x42}, "ld [hl], $42", 2, 12, 0},
+		{0x0100, []byte{0xC4, 0x00, 0x40}, "call nz, $4000", 3, 12, 24},
+		{0x0100, []byte{0xC9}, "ret", 1, 16, 0},
+		{0x0100, []byte{0xCD, 0x50, 0x01}, "call $0150", 3, 24, 0},
+		{0x0100, []byte{0xD3}, "db $D3", 1, 4, 0},
+		{0x0100, []byte{0xE0, 0x40}, "ldh [$FF40], a", 2, 12, 0},
+		{0x0100, []byte{0xE8, 0x05}, "add sp, 5", 2, 16, 0},
+		{0x0100, []byte{0xE8, 0xFB}, "add sp, -5", 2, 16, 0},
+		{0x0100, []byte{0xF8, 0x05}, "ld hl, sp+5", 2, 12, 0},
+		{0x0100, []byte{0xF8, 0xFB}, "ld hl, sp-5", 2, 12, 0},
+		{0x0100, []byte{0xFF}, "rst $38", 1, 16, 0},
+		{0x0100, []byte{0xCB, 0x37}, "swap a", 2, 8, 0},
+		{0x0100, []byte{0xCB, 0x06}, "rlc [hl]", 2, 16, 0},
+		{0x0100, []byte{0xCB, 0x46}, "bit 0, [hl]", 2, 12, 0},
+		{0x0100, []byte{0xCB, 0xFE}, "set 7, [hl]", 2, 16, 0},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(fmt.Sprintf("% X", test.code), func(t *testing.T) {
+			inst := Decode(read(test.address, test.code), test.address)
+			if inst.Text != test.text {
+				t.Errorf("got %q, want %q", inst.Text, test.text)
+			}
+			if inst.Length() != test.length {
+				t.Errorf("got length %d, want %d", inst.Length(), test.length)
+			}
+			if inst.Cycles != test.cycles || inst.BranchCycles != test.branchCycles {
+				t.Errorf("got %d/%d cycles, want %d/%d", inst.Cycles, inst.BranchCycles, test.cycles, test.branchCycles)
+			}
+		})
+	}
+}
+
+func TestSymbolize(t *testing.T) {
+	names := map[uint16]string{0x0038: "Crash", 0x0150: "Start", 0xFF40: "rLCDC", 0x0107: "Start.loop"}
+	name := func(address uint16) string { return names[address] }
+	tests := []struct {
+		code []byte
+		want string
+	}{
+		{[]byte{0xFF}, "rst Crash"},
+		{[]byte{0xCD, 0x50, 0x01}, "call Start"},
+		{[]byte{0xE0, 0x40}, "ldh [rLCDC], a"},
+		{[]byte{0x18, 0x05}, "jr Start.loop"},
+		// No name for the target
+		{[]byte{0xC3, 0x00, 0x20}, "jp $2000"},
+		// No target
+		{[]byte{0x3E, 0x38}, "ld a, $38"},
+	}
+	for _, test := range tests {
+		inst := Decode(read(0x0100, test.code), 0x0100)
+		if got := inst.Symbolize(name); got != test.want {
+			t.Errorf("% X: got %q, want %q", test.code, got, test.want)
+		}
+	}
+}
+
+// read returns a function which reads code placed at an address, and 0xFF
+// elsewhere.
+func read(address uint16, code []byte) func(uint16) byte {
+	return func(a uint16) byte {
+		if a < address || int(a-address) >= len(code) {
+			return 0xFF
+		}
+		return code[a-address]
+	}
+}
@@ -0,0 +1,446 @@
+package gb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gameboy/apu"
+	"gameboy/bits"
+	"io"
+	"os"
+)
+
+// Best Effort Save State (BESS) is the save state format used by SameBoy and
+// other emulators to share states. It is a list of blocks appended to an
+// emulator's own state, found from a footer at the end of the file, which
+// give the state of the machine as seen by the game.
+const (
+	bessMagic        = "BESS"
+	bessMajorVersion = 1
+	bessMinorVersion = 1
+	bessName         = "Batata"
+)
+
+// bessBlockHeader is the start of each BESS block.
+type bessBlockHeader struct {
+	ID     [4]byte
+	Length uint32
+}
+
+// bessBuffer is the size and position in the file of a block of memory.
+type bessBuffer struct {
+	Size   uint32
+	Offset uint32
+}
+
+// bessCore is the contents of the CORE block.
+type bessCore struct {
+	Major, Minor uint16
+	// The model, where the first character is G for DMG, S for SGB and C
+	// for CGB.
+	Model [4]byte
+
+	PC, AF, BC, DE, HL, SP uint16
+	IME                    byte
+	IE                     byte
+	// 0 if running, 1 if halted and 2 if stopped.
+	ExecutionState byte
+	Reserved       byte
+
+	// The registers at 0xFF00-0xFF7F.
+	Registers [0x80]byte
+
+	RAM         bessBuffer
+	VRAM        bessBuffer
+	MBCRAM      bessBuffer
+	OAM         bessBuffer
+	HRAM        bessBuffer
+	BGPalettes  bessBuffer
+	OBJPalettes bessBuffer
+}
+
+// SaveBESS writes a save state which other emulators can load. It is the
+// state written by SaveState followed by BESS blocks, so it can be loaded
+// fully by LoadState or as a BESS state by LoadBESS.
+func (gb *Gameboy) SaveBESS(w io.Writer) error {
+	var buf bytes.Buffer
+	if err := gb.SaveState(&buf); err != nil {
+		return err
+	}
+
+	addBuffer := func(data []byte) bessBuffer {
+		b := bessBuffer{Size: uint32(len(data)), Offset: uint32(buf.Len())}
+		buf.Write(data)
+		return b
+	}
+	ramBanks, vramSize, paletteSize := 2, 0x2000, 0
+	if gb.cgbMode {
+		ramBanks, vramSize, paletteSize = 8, 0x4000, 0x40
+	}
+
+	core := bessCore{
+		Major:          bessMajorVersion,
+		Minor:          bessMinorVersion,
+		Model:          [4]byte{'G', 'D', ' ', ' '},
+		PC:             gb.CPU.PC,
+		AF:             uint16(gb.CPU.A)<<8 | uint16(gb.CPU.F),
+		BC:             uint16(gb.CPU.B)<<8 | uint16(gb.CPU.C),
+		DE:             uint16(gb.CPU.D)<<8 | uint16(gb.CPU.E),
+		HL:             uint16(gb.CPU.H)<<8 | uint16(gb.CPU.L),
+		SP:             gb.CPU.SP,
+		IME:            bits.B(gb.CPU.IME),
+		IE:             gb.Memory.Hram[0xFF],
+		ExecutionState: gb.bessExecutionState(),
+		Registers:      gb.bessRegisters(),
+		RAM:            addBuffer(gb.Memory.bessRAM(ramBanks)),
+		VRAM:           addBuffer(gb.Memory.Vram[:vramSize]),
+		MBCRAM:         addBuffer(gb.Memory.Cart.RAMData()),
+		OAM:            addBuffer(gb.Memory.Oam[:0xA0]),
+		HRAM:           addBuffer(gb.Memory.Hram[0x80:0xFF]),
+		BGPalettes:     addBuffer(gb.BGPalette.Palette[:paletteSize]),
+		OBJPalettes:    addBuffer(gb.SpritePalette.Palette[:paletteSize]),
+	}
+	if gb.cgbMode {
+		core.Model = [4]byte{'C', 'C', ' ', ' '}
+	}
+
+	blocksStart := buf.Len()
+	writeBESSBlock(&buf, "NAME", []byte(bessName))
+	writeBESSBlock(&buf, "INFO", gb.bessInfo())
+
+	var coreData bytes.Buffer
+	binary.Write(&coreData, binary.LittleEndian, &core)
+	writeBESSBlock(&buf, "CORE", coreData.Bytes())
+
+	if writes := gb.Memory.Cart.RegisterWrites(); len(writes) > 0 {
+		var mbc bytes.Buffer
+		for _, write := range writes {
+			binary.Write(&mbc, binary.LittleEndian, write.Address)
+			mbc.WriteByte(write.Value)
+		}
+		writeBESSBlock(&buf, "MBC ", mbc.Bytes())
+	}
+	if rtc := gb.Memory.Cart.RTCData(); rtc != nil {
+		writeBESSBlock(&buf, "RTC ", rtc)
+	}
+	writeBESSBlock(&buf, "END ", nil)
+
+	binary.Write(&buf, binary.LittleEndian, uint32(blocksStart))
+	buf.WriteString(bessMagic)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
+
+// bessExecutionState returns whether the CPU is running, halted or stopped.
+func (gb *Gameboy) bessExecutionState() byte {
+	switch {
+	case gb.CPU.Stopped:
+		return 2
+	case gb.CPU.Halted:
+		return 1
+	}
+	return 0
+}
+
+func writeBESSBlock(buf *bytes.Buffer, id string, data []byte) {
+	header := bessBlockHeader{Length: uint32(len(data))}
+	copy(header.ID[:], id)
+	binary.Write(buf, binary.LittleEndian, &header)
+	buf.Write(data)
+}
+
+// bessInfo returns the contents of the INFO block, which is the title and
+// global checksum from the cartridge header.
+func (gb *Gameboy) bessInfo() []byte {
+	info := make([]byte, 0x12)
+	for i := range info[:0x10] {
+		info[i] = gb.Memory.Cart.Read(0x134 + uint16(i))
+	}
+	info[0x10] = gb.Memory.Cart.Read(0x14E)
+	info[0x11] = gb.Memory.Cart.Read(0x14F)
+	return info
+}
+
+// bessRegisters returns the values of the registers at 0xFF00-0xFF7F.
+func (gb *Gameboy) bessRegisters() [0x80]byte {
+	var registers [0x80]byte
+	for i := range registers {
+		address := 0xFF00 + uint16(i)
+		switch {
+		case address == 0xFF46:
+			// The DMA register can not be read back
+			registers[i] = gb.Memory.Hram[i]
+		case address >= 0xFF10 && address <= 0xFF3F:
+			// Reading the sound registers masks the write-only bits
+			registers[i] = gb.Sound.Register(address)
+		default:
+			registers[i] = gb.Memory.ReadHighRam(address)
+		}
+	}
+	return registers
+}
+
+// bessRAM returns the first banks of work RAM in the BESS layout, where bank n
+// is at n*0x1000. Wram is addressed with the bank added to the offset into
+// 0xC000-0xDFFF, so it keeps bank n at (n+1)*0x1000 for banks 1-7.
+func (m *Memory) bessRAM(banks int) []byte {
+	ram := make([]byte, banks*0x1000)
+	copy(ram, m.Wram[:0x1000])
+	copy(ram[0x1000:], m.Wram[0x2000:])
+	return ram
+}
+
+// loadBESSRAM sets the work RAM from the BESS layout.
+func (m *Memory) loadBESSRAM(ram []byte) {
+	copy(m.Wram[:0x1000], ram)
+	if len(ram) > 0x1000 {
+		copy(m.Wram[0x2000:], ram[0x1000:])
+	}
+}
+
+// bessState is the blocks read from a BESS save state.
+type bessState struct {
+	data []byte
+	core *bessCore
+	info []byte
+	mbc  []byte
+	rtc  []byte
+}
+
+// LoadBESS loads a BESS save state, such as one saved by SameBoy. The state
+// only holds what the game can see of the machine, so the internal timing of
+// the hardware is not restored exactly. The state must be from the same game
+// and in the same DMG or CGB mode. If it can not be loaded the machine is left
+// as it was.
+func (gb *Gameboy) LoadBESS(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to load BESS state: %w", err)
+	}
+	state, err := parseBESS(data)
+	if err != nil {
+		return fmt.Errorf("failed to load BESS state: %w", err)
+	}
+	if err := gb.checkBESS(state); err != nil {
+		return fmt.Errorf("failed to load BESS state: %w", err)
+	}
+	gb.applyBESS(state)
+	return nil
+}
+
+// parseBESS finds the blocks in a BESS save state and checks they are valid.
+func parseBESS(data []byte) (*bessState, error) {
+	if len(data) < 8 || string(data[len(data)-4:]) != bessMagic {
+		return nil, errors.New("not a BESS save state")
+	}
+	end := len(data) - 8
+	offset := int(binary.LittleEndian.Uint32(data[end:]))
+
+	state := &bessState{data: data}
+	for {
+		if offset+8 > end {
+			return nil, errors.New("missing END block")
+		}
+		var header bessBlockHeader
+		binary.Read(bytes.NewReader(data[offset:offset+8]), binary.LittleEndian, &header)
+		offset += 8
+		if offset+int(header.Length) > end {
+			return nil, fmt.Errorf("block %q is truncated", header.ID[:])
+		}
+		block := data[offset : offset+int(header.Length)]
+		offset += int(header.Length)
+
+		switch string(header.ID[:]) {
+		case "CORE":
+			var core bessCore
+			if err := binary.Read(bytes.NewReader(block), binary.LittleEndian, &core); err != nil {
+				return nil, fmt.Errorf("invalid CORE block: %w", err)
+			}
+			state.core = &core
+		case "INFO":
+			state.info = block
+		case "MBC ":
+			state.mbc = block
+		case "RTC ":
+			state.rtc = block
+		case "END ":
+			if state.core == nil {
+				return nil, errors.New("missing CORE block")
+			}
+			return state, nil
+		}
+	}
+}
+
+// buffer returns the data of one of the memory buffers in the state.
+func (s *bessState) buffer(b bessBuffer) []byte {
+	return s.data[b.Offset : b.Offset+b.Size]
+}
+
+// checkBESS checks a BESS state can be loaded into the running game.
+func (gb *Gameboy) checkBESS(state *bessState) error {
+	core := state.core
+	if core.Major != bessMajorVersion {
+		return fmt.Errorf("unsupported version %d.%d", core.Major, core.Minor)
+	}
+	if len(state.info) >= 0x12 {
+		checksum := uint16(state.info[0x10])<<8 | uint16(state.info[0x11])
+		if expected := gb.Memory.Cart.Header().GlobalChecksum; checksum != expected {
+			return fmt.Errorf("it was saved from a different game (checksum %04x), not %s (checksum %04x)",
+				checksum, gb.Memory.Cart.GetName(), expected)
+		}
+	}
+	if cgb := core.Model[0] == 'C'; cgb != gb.cgbMode {
+		return fmt.Errorf("it was saved from a %c model, which does not match the running mode", core.Model[0])
+	}
+	if len(state.mbc)%3 != 0 {
+		return errors.New("invalid MBC block")
+	}
+	for _, b := range []bessBuffer{core.RAM, core.VRAM, core.MBCRAM, core.OAM, core.HRAM, core.BGPalettes, core.OBJPalettes} {
+		if uint64(b.Offset)+uint64(b.Size) > uint64(len(state.data)) {
+			return errors.New("memory buffer is outside the file")
+		}
+	}
+	return nil
+}
+
+// applyBESS puts the machine into the state read from a BESS save state.
+func (gb *Gameboy) applyBESS(state *bessState) {
+	core := state.core
+	cpu := gb.CPU
+	cpu.PC, cpu.SP = core.PC, core.SP
+	cpu.A, cpu.F = byte(core.AF>>8), byte(core.AF)&0xF0
+	cpu.B, cpu.C = byte(core.BC>>8), byte(core.BC)
+	cpu.D, cpu.E = byte(core.DE>>8), byte(core.DE)
+	cpu.H, cpu.L = byte(core.HL>>8), byte(core.HL)
+	cpu.setFlagsFromF()
+	cpu.setBC()
+	cpu.setDE()
+	cpu.setHL()
+	cpu.IME = core.IME != 0
+	cpu.InterruptsEnabling = false
+	// STOP halts the CPU as well as stopping it
+	gb.CPU.Halted = core.ExecutionState != 0
+	gb.CPU.Stopped = core.ExecutionState == 2
+
+	m := gb.Memory
+	m.loadBESSRAM(state.buffer(core.RAM))
+	copy(m.Vram[:], state.buffer(core.VRAM))
+	copy(m.Oam[:], state.buffer(core.OAM))
+	copy(m.Hram[0x80:0xFF], state.buffer(core.HRAM))
+	copy(gb.BGPalette.Palette, state.buffer(core.BGPalettes))
+	copy(gb.SpritePalette.Palette, state.buffer(core.OBJPalettes))
+	if ram := state.buffer(core.MBCRAM); len(ram) > 0 {
+		m.Cart.LoadRAMData(ram)
+	}
+	m.Hram[0xFF] = core.IE
+	gb.loadBESSRegisters(&core.Registers)
+
+	for i := 0; i+3 <= len(state.mbc); i += 3 {
+		address := binary.LittleEndian.Uint16(state.mbc[i:])
+		if address < 0x8000 {
+			m.Cart.WriteROM(address, state.mbc[i+2])
+		}
+	}
+	if state.rtc != nil {
+		m.Cart.LoadRTCData(state.rtc)
+	}
+
+	// Start the current scanline and timer periods again, as their
+	// progress is not part of the state.
+	gb.scanlineCounter = 456
+	gb.timerCounter = 0
+	cpu.Divider = 0
+}
+
+// loadBESSRegisters sets the registers at 0xFF00-0xFF7F without the side
+// effects of writing them, such as starting a DMA transfer.
+func (gb *Gameboy) loadBESSRegisters(registers *[0x80]byte) {
+	m := gb.Memory
+	for i, value := range registers {
+		address := 0xFF00 + uint16(i)
+		switch {
+		case address >= 0xFF10 && address <= 0xFF3F:
+			// Sound registers are written below
+		case address == TAC:
+			m.Hram[i] = value | 0xF8
+		case address == 0xFF41:
+			m.Hram[i] = value | 0x80
+		case address == 0xFF4D:
+			gb.currentSpeed = value >> 7
+			gb.prepareSpeed = bits.Test(value, 0)
+		case address == 0xFF4F:
+			m.VramBank = value & 0x1
+		case address == 0xFF55:
+			// HDMA is active if bit 7 is clear
+			m.Hram[i] = value
+			m.hdmaActive = gb.cgbMode && !bits.Test(value, 7)
+			m.hdmaLength = value & 0x7F
+		case address == 0xFF68:
+			gb.BGPalette.updateIndex(value)
+		case address == 0xFF6A:
+			gb.SpritePalette.updateIndex(value)
+		case address == 0xFF69 || address == 0xFF6B:
+			// Palette data is restored from the palette buffers
+		case address == 0xFF70:
+			m.WramBank = value & 0x7
+			if m.WramBank == 0 {
+				m.WramBank = 1
+			}
+		default:
+			m.Hram[i] = value
+		}
+	}
+
+	// Power the APU on or off first, as the other registers can only be
+	// written while it is on. The progress of the channels is not part of
+	// the state, so the ones which were playing are started again by
+	// writing the trigger bit.
+	gb.Sound.Init(gb.cgbMode)
+	status := registers[apu.NR52-0xFF00]
+	gb.Sound.Write(apu.NR52, status)
+	for address := uint16(0xFF30); address <= 0xFF3F; address++ {
+		gb.Sound.WriteWaveform(address, registers[address-0xFF00])
+	}
+	for address := uint16(apu.NR10); address < apu.NR52; address++ {
+		value := registers[address-0xFF00]
+		switch address {
+		case apu.NR14, apu.NR24, apu.NR34, apu.NR44:
+			channel := (address - apu.NR14) / 5
+			value &^= 0x80
+			if bits.Test(status, byte(channel)) {
+				value |= 0x80
+			}
+		}
+		gb.Sound.Write(address, value)
+	}
+}
+
+// LoadStateFile loads a save state file, which can be one saved by SaveState,
+// a quick save slot or a BESS state saved by another emulator.
+func (gb *Gameboy) LoadStateFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	r := bytes.NewReader(data)
+	switch {
+	case bytes.HasPrefix(data, []byte(stateMagic)):
+		return gb.LoadState(r)
+	case bytes.HasPrefix(data, []byte(slotMagic)):
+		header, err := readSlotHeader(r)
+		if err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+		if _, err := r.Seek(int64(header.ThumbnailSize), io.SeekCurrent); err != nil {
+			return fmt.Errorf("failed to load state: %w", err)
+		}
+		return gb.LoadState(r)
+	default:
+		return gb.LoadBESS(r)
+	}
+}
@@ -0,0 +1,233 @@
+package gb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"gameboy/apu"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newBESSTestGameboy creates a Gameboy running an empty MBC3 cart with an
+// RTC and 32KB of RAM, using a virtual clock so the RTC does not move.
+func newBESSTestGameboy(t *testing.T) *Gameboy {
+	rom := make([]byte, 0x10000)
+	rom[0x147] = 0x10 // MBC3+TIMER+RAM+BATTERY
+	rom[0x148] = 0x01 // 64KB
+	rom[0x149] = 0x03 // 32KB
+	epoch := time.Unix(0, 0)
+	gameboy, err := New(Options{ROM: rom, RTCEpoch: &epoch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gameboy
+}
+
+func TestBESSRoundTrip(t *testing.T) {
+	gameboy := newBESSTestGameboy(t)
+	cpu := gameboy.CPU
+	cpu.PC, cpu.SP = 0x1234, 0xCFF0
+	cpu.A, cpu.B, cpu.C, cpu.D, cpu.E, cpu.H, cpu.L = 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07
+
+	bus := cpu.Bus
+	bus.Write(apu.NR52, 0x80)
+	bus.Write(apu.NR13, 0x34)
+	bus.Write(apu.NR14, 0x05)
+	bus.Write(0x0000, 0x0A) // Enable RAM
+	bus.Write(0x2000, 0x02) // ROM bank 2
+	bus.Write(0x4000, 0x01) // RAM bank 1
+	bus.Write(0xA000, 0x42)
+	gameboy.Memory.Cart.SetRTC(26*time.Hour + 3*time.Minute + 4*time.Second)
+
+	var saved bytes.Buffer
+	if err := gameboy.SaveBESS(&saved); err != nil {
+		t.Fatal(err)
+	}
+	state, err := parseBESS(saved.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nr13, nr14 := state.core.Registers[0x13], state.core.Registers[0x14]; nr13 != 0x34 || nr14 != 0x05 {
+		t.Errorf("NR13, NR14 saved as %02X, %02X, want 34, 05", nr13, nr14)
+	}
+
+	loaded := newBESSTestGameboy(t)
+	if err := loaded.LoadBESS(bytes.NewReader(saved.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	// CORE
+	want, got := gameboy.CPU, loaded.CPU
+	if got.PC != want.PC || got.SP != want.SP {
+		t.Errorf("PC, SP = %04X, %04X, want %04X, %04X", got.PC, got.SP, want.PC, want.SP)
+	}
+	wantRegs := []byte{want.A, want.B, want.C, want.D, want.E, want.H, want.L}
+	gotRegs := []byte{got.A, got.B, got.C, got.D, got.E, got.H, got.L}
+	if !bytes.Equal(gotRegs, wantRegs) {
+		t.Errorf("registers = % X, want % X", gotRegs, wantRegs)
+	}
+	if got, want := loaded.bessRegisters(), gameboy.bessRegisters(); got != want {
+		t.Errorf("I/O registers = % X, want % X", got, want)
+	}
+
+	// MBC
+	wantCart, gotCart := gameboy.Memory.Cart, loaded.Memory.Cart
+	if got, want := gotCart.RegisterWrites(), wantCart.RegisterWrites(); !reflect.DeepEqual(got, want) {
+		t.Errorf("MBC registers = %v, want %v", got, want)
+	}
+	if got := loaded.CPU.Bus.Read(0xA000); got != 0x42 {
+		t.Errorf("RAM bank 1 = %02X, want 42", got)
+	}
+
+	// RTC
+	if got, want := gotCart.RTCData(), wantCart.RTCData(); !bytes.Equal(got[:40], want[:40]) {
+		t.Errorf("RTC registers = % X, want % X", got[:40], want[:40])
+	}
+}
+
+// bessFixture returns a BESS state built by hand from the specification, with
+// the blocks at fixed offsets rather than written by SaveBESS. The memory
+// buffers come first, as in a SameBoy state, then the blocks from blocksStart.
+func bessFixture(executionState byte) []byte {
+	const (
+		ramOffset    = 0x0000 // 8KB of work RAM
+		vramOffset   = 0x2000 // 8KB of video RAM
+		mbcRAMOffset = 0x4000 // 32KB of cart RAM
+		oamOffset    = 0xC000
+		hramOffset   = 0xC0A0
+		blocksStart  = 0xC120
+	)
+	data := make([]byte, blocksStart)
+	data[ramOffset] = 0x11           // 0xC000
+	data[ramOffset+0x1000] = 0x22    // 0xD000
+	data[vramOffset] = 0x33          // 0x8000
+	data[mbcRAMOffset+0x2000] = 0x44 // 0xA000 in RAM bank 1
+	data[oamOffset] = 0x55           // 0xFE00
+	data[hramOffset] = 0x66          // 0xFF80
+
+	le := binary.LittleEndian
+	block := func(id string, contents []byte) {
+		data = append(data, id...)
+		data = le.AppendUint32(data, uint32(len(contents)))
+		data = append(data, contents...)
+	}
+	block("NAME", []byte("Fixture"))
+
+	// The title and global checksum, which is 0 in the test cart
+	info := make([]byte, 0x12)
+	copy(info, "TESTGAME")
+	block("INFO", info)
+
+	core := make([]byte, 0xD0)
+	le.PutUint16(core[0x00:], 1) // Major version
+	le.PutUint16(core[0x02:], 1) // Minor version
+	copy(core[0x04:], "GD  ")
+	le.PutUint16(core[0x08:], 0x4321) // PC
+	le.PutUint16(core[0x0A:], 0x12B0) // AF
+	le.PutUint16(core[0x0C:], 0x3456) // BC
+	le.PutUint16(core[0x0E:], 0x789A) // DE
+	le.PutUint16(core[0x10:], 0xBCDE) // HL
+	le.PutUint16(core[0x12:], 0xDFF0) // SP
+	core[0x14] = 1                    // IME
+	core[0x15] = 0x05                 // IE
+	core[0x16] = executionState
+	core[0x18+0x40] = 0x91 // LCDC
+	core[0x18+0x43] = 0x07 // SCX
+	core[0x18+0x47] = 0xE4 // BGP
+	buffers := []struct{ size, offset uint32 }{
+		{0x2000, ramOffset},
+		{0x2000, vramOffset},
+		{0x8000, mbcRAMOffset},
+		{0xA0, oamOffset},
+		{0x7F, hramOffset},
+		{0, 0}, // No CGB palettes
+		{0, 0},
+	}
+	for i, b := range buffers {
+		le.PutUint32(core[0x98+i*8:], b.size)
+		le.PutUint32(core[0x9C+i*8:], b.offset)
+	}
+	block("CORE", core)
+
+	block("MBC ", []byte{
+		0x00, 0x00, 0x0A, // Enable RAM
+		0x00, 0x20, 0x02, // ROM bank 2
+		0x00, 0x40, 0x01, // RAM bank 1
+	})
+	block("END ", nil)
+	data = le.AppendUint32(data, blocksStart)
+	return append(data, "BESS"...)
+}
+
+func TestLoadBESSFixture(t *testing.T) {
+	tests := []struct {
+		executionState  byte
+		halted, stopped bool
+	}{
+		{0, false, false},
+		{1, true, false},
+		{2, true, true},
+	}
+	for _, tt := range tests {
+		gameboy := newBESSTestGameboy(t)
+		if err := gameboy.LoadBESS(bytes.NewReader(bessFixture(tt.executionState))); err != nil {
+			t.Fatal(err)
+		}
+
+		cpu := gameboy.CPU
+		if cpu.Halted != tt.halted || cpu.Stopped != tt.stopped {
+			t.Errorf("execution state %d: halted, stopped = %v, %v, want %v, %v",
+				tt.executionState, cpu.Halted, cpu.Stopped, tt.halted, tt.stopped)
+		}
+		if tt.executionState != 0 {
+			continue
+		}
+
+		gotRegs := []uint16{cpu.PC, uint16(cpu.A)<<8 | uint16(cpu.F), uint16(cpu.B)<<8 | uint16(cpu.C),
+			uint16(cpu.D)<<8 | uint16(cpu.E), uint16(cpu.H)<<8 | uint16(cpu.L), cpu.SP}
+		wantRegs := []uint16{0x4321, 0x12B0, 0x3456, 0x789A, 0xBCDE, 0xDFF0}
+		if !reflect.DeepEqual(gotRegs, wantRegs) {
+			t.Errorf("PC, AF, BC, DE, HL, SP = %04X, want %04X", gotRegs, wantRegs)
+		}
+		if !cpu.IME || gameboy.Memory.Hram[0xFF] != 0x05 {
+			t.Errorf("IME, IE = %v, %02X, want true, 05", cpu.IME, gameboy.Memory.Hram[0xFF])
+		}
+		for _, r := range []struct {
+			address uint16
+			want    byte
+		}{{0xFF40, 0x91}, {0xFF43, 0x07}, {0xFF47, 0xE4}} {
+			if got := gameboy.Memory.Hram[r.address-0xFF00]; got != r.want {
+				t.Errorf("register %04X = %02X, want %02X", r.address, got, r.want)
+			}
+		}
+
+		for _, m := range []struct {
+			address uint16
+			want    byte
+		}{{0xC000, 0x11}, {0xD000, 0x22}, {0x8000, 0x33}, {0xA000, 0x44}, {0xFE00, 0x55}, {0xFF80, 0x66}} {
+			if got := cpu.Bus.Read(m.address); got != m.want {
+				t.Errorf("memory at %04X = %02X, want %02X", m.address, got, m.want)
+			}
+		}
+	}
+}
+
+func TestBESSExecutionState(t *testing.T) {
+	for _, want := range []byte{0, 1, 2} {
+		gameboy := newBESSTestGameboy(t)
+		gameboy.CPU.Halted = want != 0
+		gameboy.CPU.Stopped = want == 2
+		var saved bytes.Buffer
+		if err := gameboy.SaveBESS(&saved); err != nil {
+			t.Fatal(err)
+		}
+		state, err := parseBESS(saved.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := state.core.ExecutionState; got != want {
+			t.Errorf("execution state saved as %d, want %d", got, want)
+		}
+	}
+}
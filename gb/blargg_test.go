@@ -0,0 +1,160 @@
+package gb
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// blarggDir is where Blargg's test ROMs are kept.
+const blarggDir = "../gb-test-roms"
+
+// blarggSignature is written to $A001-$A003 by the test ROMs which report
+// their result in the cart RAM.
+var blarggSignature = []byte{0xDE, 0xB0, 0x61}
+
+var blarggAll = flag.Bool("blargg.all", false, "also run the blargg tests which are known to fail")
+
+// blarggStatusRunning is the status in $A000 while a test is running.
+const blarggStatusRunning = 0x80
+
+// blarggTests are the ROMs to run, as patterns relative to blarggDir. Each ROM
+// is a sub-test, so a single failure can be run with -run.
+var blarggTests = []struct {
+	pattern string
+	cgb     bool
+	// Emulated seconds to wait for the result.
+	timeout int
+	// Why the ROMs are known to fail, which skips them unless -blargg.all
+	// is given.
+	knownFailure string
+}{
+	{pattern: "cpu_instrs/individual/*.gb", timeout: 40},
+	{pattern: "dmg_sound/rom_singles/*.gb", timeout: 30},
+	{pattern: "cgb_sound/rom_singles/*.gb", cgb: true, timeout: 30},
+	{pattern: "oam_bug/rom_singles/[36]-*.gb", timeout: 10},
+
+	{pattern: "instr_timing/instr_timing.gb", timeout: 10, knownFailure: "hangs after printing its name"},
+	{pattern: "mem_timing/individual/*.gb", timeout: 10, knownFailure: "memory is accessed at the end of instructions"},
+	{pattern: "mem_timing-2/rom_singles/*.gb", timeout: 10, knownFailure: "memory is accessed at the end of instructions"},
+	{pattern: "halt_bug.gb", timeout: 10, knownFailure: "the halt bug is not emulated"},
+	{pattern: "interrupt_time/interrupt_time.gb", cgb: true, timeout: 10, knownFailure: "never prints a result"},
+	{pattern: "oam_bug/rom_singles/[124578]-*.gb", timeout: 10, knownFailure: "the OAM corruption bug is not emulated"},
+}
+
+func TestBlargg(t *testing.T) {
+	for _, test := range blarggTests {
+		roms, err := filepath.Glob(filepath.Join(blarggDir, test.pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(roms) == 0 {
+			t.Errorf("no test roms match %s", test.pattern)
+		}
+		for _, rom := range roms {
+			test, rom := test, rom
+			name, _ := filepath.Rel(blarggDir, rom)
+			t.Run(filepath.ToSlash(name), func(t *testing.T) {
+				if test.knownFailure != "" && !*blarggAll {
+					t.Skip(test.knownFailure)
+				}
+				if testing.Short() && test.timeout > 10 {
+					t.Skip("skipping slow test in short mode")
+				}
+				t.Parallel()
+				result, err := runBlargg(rom, test.cgb, test.timeout)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !result.passed {
+					t.Errorf("%s\n%s", result.status, result.output)
+				}
+			})
+		}
+	}
+}
+
+// blarggResult is the outcome of a test ROM.
+type blarggResult struct {
+	passed bool
+	// Why the test passed or failed, such as "Passed" or "timed out".
+	status string
+	// The text the ROM printed.
+	output string
+}
+
+// runBlargg runs a test ROM until it reports a result or the timeout in
+// emulated seconds passes. The result is read from the signature in the cart
+// RAM if the ROM writes one, and otherwise from the "Passed" or "Failed" it
+// prints over the serial port.
+func runBlargg(rom string, cgb bool, timeout int) (blarggResult, error) {
+	data, err := os.ReadFile(rom)
+	if err != nil {
+		return blarggResult{}, err
+	}
+	var serial bytes.Buffer
+	gameboy, err := New(Options{ROM: data, CGB: cgb, SerialOutput: &serial})
+	if err != nil {
+		return blarggResult{}, err
+	}
+
+	for frame := 0; frame < timeout*FramesSecond; frame++ {
+		gameboy.Update()
+		if status, output, ok := blarggMemoryResult(gameboy.Memory); ok {
+			result := blarggResult{passed: status == 0, status: "Passed", output: output}
+			if !result.passed {
+				result.status = fmt.Sprintf("Failed with status %d", status)
+			}
+			return result, nil
+		}
+		output := serial.String()
+		switch {
+		case strings.Contains(output, "Passed"):
+			return blarggResult{passed: true, status: "Passed", output: output}, nil
+		case strings.Contains(output, "Failed"):
+			// Wait a moment for the rest of the reason to be printed.
+			for i := 0; i < FramesSecond; i++ {
+				gameboy.Update()
+			}
+			return blarggResult{status: "Failed", output: serial.String()}, nil
+		}
+	}
+	output := serial.String()
+	if _, text, ok := blarggMemoryText(gameboy.Memory); ok {
+		output = text
+	}
+	return blarggResult{status: fmt.Sprintf("timed out after %d seconds", timeout), output: output}, nil
+}
+
+// blarggMemoryResult returns the status and text of a test which has finished
+// and reported its result in the cart RAM.
+func blarggMemoryResult(m *Memory) (byte, string, bool) {
+	status, text, ok := blarggMemoryText(m)
+	if !ok || status == blarggStatusRunning {
+		return 0, "", false
+	}
+	return status, text, true
+}
+
+// blarggMemoryText returns the status and the text in the cart RAM if the
+// test has written the signature.
+func blarggMemoryText(m *Memory) (byte, string, bool) {
+	for i, b := range blarggSignature {
+		if m.ReadByte(0xA001+uint16(i)) != b {
+			return 0, "", false
+		}
+	}
+	var text strings.Builder
+	for address := uint16(0xA004); address < 0xC000; address++ {
+		c := m.ReadByte(address)
+		if c == 0 {
+			break
+		}
+		text.WriteByte(c)
+	}
+	return m.ReadByte(0xA000), text.String(), true
+}
@@ -0,0 +1,50 @@
+package gb
+
+// Bus is what the CPU is connected to. Memory is the bus of the GameBoy, and
+// the CPU can be run on any other bus, such as a flat 64 KiB of RAM in tests
+// or one which wraps Memory to log every access.
+type Bus interface {
+	// Read reads a byte of memory.
+	Read(address uint16) byte
+	// Write writes a byte of memory.
+	Write(address uint16, value byte)
+	// Tick runs the rest of the machine for the cycles the CPU has used.
+	Tick(cycles int)
+}
+
+// fetcher is implemented by buses which read the bytes of instructions
+// differently from data.
+type fetcher interface {
+	// Fetch reads a byte of an instruction.
+	Fetch(address uint16) byte
+}
+
+// Read reads a byte from memory, as the CPU sees it.
+func (m *Memory) Read(address uint16) byte {
+	return m.ReadByte(address)
+}
+
+// Fetch reads a byte of an instruction from memory. Unlike Read it does not
+// trigger read watchpoints, as running code is watched by checkExecute.
+func (m *Memory) Fetch(address uint16) byte {
+	return m.readByte(address)
+}
+
+// Write writes a byte to memory, as the CPU does.
+func (m *Memory) Write(address uint16, value byte) {
+	m.WriteByte(address, value)
+}
+
+// Tick runs the PPU, timers, APU and cart for a number of cycles. Their
+// accesses to memory are not made by the CPU, so they are not watched by the
+// debugger.
+func (m *Memory) Tick(cycles int) {
+	watching := m.watching
+	m.watching = false
+	gb := m.gb
+	gb.updateGraphics(cycles)
+	gb.updateTimers(cycles)
+	gb.Sound.Buffer(cycles, gb.getSpeed())
+	m.Cart.Tick(cycles, gb.getSpeed())
+	m.watching = watching
+}
@@ -0,0 +1,90 @@
+package gb
+
+import (
+	"reflect"
+	"testing"
+)
+
+// recordingBus wraps a bus and records the CPU's accesses.
+type recordingBus struct {
+	Bus
+	reads, writes []uint16
+	cycles        int
+}
+
+func (b *recordingBus) Read(address uint16) byte {
+	b.reads = append(b.reads, address)
+	return b.Bus.Read(address)
+}
+
+func (b *recordingBus) Write(address uint16, value byte) {
+	b.writes = append(b.writes, address)
+	b.Bus.Write(address, value)
+}
+
+func (b *recordingBus) Tick(cycles int) {
+	b.cycles += cycles
+	b.Bus.Tick(cycles)
+}
+
+func TestWrappedBus(t *testing.T) {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x100:], []byte{
+		0x3E, 0x42, //       0100 ld a, $42
+		0xEA, 0x00, 0xC0, // 0102 ld [$C000], a
+	})
+	gameboy, err := New(Options{ROM: rom})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := &recordingBus{Bus: gameboy.CPU.Bus}
+	gameboy.CPU.Bus = bus
+
+	gameboy.StepInstruction()
+	gameboy.StepInstruction()
+
+	if want := []uint16{0x100, 0x101, 0x102, 0x103, 0x104}; !reflect.DeepEqual(bus.reads, want) {
+		t.Errorf("got reads %04X, want %04X", bus.reads, want)
+	}
+	if want := []uint16{0xC000}; !reflect.DeepEqual(bus.writes, want) {
+		t.Errorf("got writes %04X, want %04X", bus.writes, want)
+	}
+	if got := gameboy.Memory.ReadByte(0xC000); got != 0x42 {
+		t.Errorf("got %02X at C000, want 42", got)
+	}
+	if bus.cycles == 0 {
+		t.Error("the bus was not ticked")
+	}
+}
+
+func TestWrappedBusInterrupt(t *testing.T) {
+	rom := make([]byte, 0x8000) // 0100 nop
+	gameboy, err := New(Options{ROM: rom})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameboy.CPU.IME = true
+	gameboy.CPU.SP = 0xDFFE
+	gameboy.Memory.Hram[0xFF] = 0x04 // Timer
+	gameboy.requestInterrupt(2)
+	bus := &recordingBus{Bus: gameboy.CPU.Bus}
+	gameboy.CPU.Bus = bus
+
+	cycles := gameboy.StepInstruction()
+
+	if gameboy.CPU.PC != 0x50 {
+		t.Errorf("got PC %04X, want 0050", gameboy.CPU.PC)
+	}
+	if want := []uint16{0xFF0F, 0xDFFD, 0xDFFC}; !reflect.DeepEqual(bus.writes, want) {
+		t.Errorf("got writes %04X, want %04X", bus.writes, want)
+	}
+	if got := gameboy.Memory.ReadByte(0xDFFD); got != 0x01 {
+		t.Errorf("got %02X at DFFD, want 01", got)
+	}
+	if got := gameboy.Memory.ReadByte(0xDFFC); got != 0x01 {
+		t.Errorf("got %02X at DFFC, want 01", got)
+	}
+	if cycles != 24 || bus.cycles != cycles {
+		t.Errorf("got %d cycles with %d ticked, want 24", cycles, bus.cycles)
+	}
+}
@@ -1,8 +1,8 @@
 package gb
 
 import (
-	"fmt"
 	"gameboy/bits"
+	"log"
 )
 
 // Rotate Left Circular
@@ -135,7 +135,7 @@ func (z *Z80) SET(bit uint, r byte) byte {
 }
 
 func (z *Z80) ExecuteCBInstruction() {
-	opcodeCB := z.readMemory(z.PC + 1)
+	opcodeCB := z.fetch(z.PC + 1)
 
 	switch opcodeCB {
 	case 0x00:
@@ -189,9 +189,9 @@ func (z *Z80) ExecuteCBInstruction() {
 		z.M = 8
 	case 0x06: // RLC (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.RLC(value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -239,9 +239,9 @@ func (z *Z80) ExecuteCBInstruction() {
 		z.M = 8
 	case 0x0E: // RRC (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.RRC(value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -296,9 +296,9 @@ func (z *Z80) ExecuteCBInstruction() {
 		z.M = 8
 	case 0x16: // RL (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.RL(value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -353,9 +353,9 @@ func (z *Z80) ExecuteCBInstruction() {
 		z.M = 8
 	case 0x1E: // RR (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.RR(value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -410,9 +410,9 @@ func (z *Z80) ExecuteCBInstruction() {
 		z.M = 8
 	case 0x26: // SLA (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.SLA(value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -466,9 +466,9 @@ func (z *Z80) ExecuteCBInstruction() {
 		z.M = 8
 	case 0x2E: // SRA (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.SRA(value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -523,9 +523,9 @@ func (z *Z80) ExecuteCBInstruction() {
 		z.M = 8
 	case 0x36: // SWAP (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.SWAP(value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -580,9 +580,9 @@ func (z *Z80) ExecuteCBInstruction() {
 		z.M = 8
 	case 0x3E: // SRL (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.SRL(value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -632,7 +632,7 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0x46:
 		// BIT 0, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		z.BIT(0, value)
 
 		z.PC += 2
@@ -682,7 +682,7 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0x4E:
 		// BIT 1, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		z.BIT(1, value)
 
 		z.PC += 2
@@ -732,7 +732,7 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0x56:
 		// BIT 2, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		z.BIT(2, value)
 
 		z.PC += 2
@@ -782,7 +782,7 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0x5E:
 		// BIT 3, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		z.BIT(3, value)
 
 		z.PC += 2
@@ -832,7 +832,7 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0x66:
 		// BIT 4, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		z.BIT(4, value)
 
 		z.PC += 2
@@ -882,7 +882,7 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0x6E:
 		// BIT 5, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		z.BIT(5, value)
 
 		z.PC += 2
@@ -932,7 +932,7 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0x76:
 		// BIT 6, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		z.BIT(6, value)
 
 		z.PC += 2
@@ -982,7 +982,7 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0x7E:
 		// BIT 7, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		z.BIT(7, value)
 
 		z.PC += 2
@@ -1038,18 +1038,18 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0x86:
 		// RES 0, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.RES(0, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
 	// case 0x86:
 	//     // RES 0, (HL)
 	//     address := z.HL
-	//     value := z.Memory.ReadByte(address)
+	//     value := z.Bus.Read(address)
 	//     value &^= (1 << 0) // Clear bit 0
-	//     z.Memory.WriteByte(address, value)
+	//     z.Bus.Write(address, value)
 	//     z.M = 16
 	case 0x87:
 		// RES 0, A
@@ -1103,9 +1103,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0x8E:
 		// RES 1, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.RES(1, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1161,9 +1161,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0x96:
 		// RES 2, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.RES(2, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1219,9 +1219,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0x9E:
 		// RES 3, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.RES(3, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1277,9 +1277,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0xA6:
 		// RES 4, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.RES(4, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1335,9 +1335,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0xAE:
 		// RES 5, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.RES(5, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1393,18 +1393,18 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0xB6:
 		// RES 6, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.RES(6, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
 	// case 0xB6:
 	// 	// RES 6, (HL)
 	// 	address := z.HL
-	// 	value := z.Memory.ReadByte(address)
+	// 	value := z.Bus.Read(address)
 	// 	value &^= (1 << 6) // Clear bit 6
-	// 	z.Memory.WriteByte(address, value)
+	// 	z.Bus.Write(address, value)
 
 	// 	z.PC += 2
 	// 	z.M = 16
@@ -1460,9 +1460,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0xBE:
 		// RES 7, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.RES(7, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1518,9 +1518,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0xC6:
 		// SET 0, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.SET(0, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1576,9 +1576,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0xCE:
 		// SET 1, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.SET(1, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1634,9 +1634,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0xD6:
 		// SET 2, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.SET(2, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1692,9 +1692,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0xDE:
 		// SET 3, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.SET(3, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1750,9 +1750,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0xE6:
 		// SET 4, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.SET(4, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1808,9 +1808,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0xEE:
 		// SET 5, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.SET(5, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1866,9 +1866,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0xF6:
 		// SET 6, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.SET(6, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1924,9 +1924,9 @@ func (z *Z80) ExecuteCBInstruction() {
 	case 0xFE:
 		// SET 7, (HL)
 		address := z.HL
-		value := z.Memory.ReadByte(address)
+		value := z.Bus.Read(address)
 		newValue := z.SET(7, value)
-		z.Memory.WriteByte(address, newValue)
+		z.Bus.Write(address, newValue)
 
 		z.PC += 2
 		z.M = 16
@@ -1938,8 +1938,7 @@ func (z *Z80) ExecuteCBInstruction() {
 		z.PC += 2
 		z.M = 8
 	default:
-		fmt.Printf("Opcode CB não suportado: 0xCB%x\n", opcodeCB)
-		fmt.Scanln()
+		log.Printf("Unsupported opcode 0xcb%02x at %#04x", opcodeCB, z.PC)
 		z.M = 4
 	}
 }
@@ -0,0 +1,100 @@
+package gb
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"time"
+)
+
+// Options are the settings for creating a Gameboy with New.
+type Options struct {
+	// ROM is the data of the game. If it is nil the game is read from
+	// ROMReader instead.
+	ROM       []byte
+	ROMReader io.Reader
+
+	// Filename of the ROM. The save file of carts with a battery is kept
+	// next to it, and no save file is used if it is empty.
+	Filename string
+
+	// CGB runs games which support it in colour mode.
+	CGB bool
+
+	// RTCEpoch, if set, makes the cart's real time clock count the emulated
+	// time from this time instead of using the time on the host.
+	RTCEpoch *time.Time
+
+	// SerialOutput, if set, receives the bytes the game sends over the
+	// link cable.
+	SerialOutput io.Writer
+
+	// RewindBudget is the number of bytes of memory used for snapshots to
+	// rewind to, taken every RewindInterval frames. Rewinding is off if
+	// the budget is 0.
+	RewindBudget   int
+	RewindInterval int
+}
+
+// New creates a Gameboy running the game in the options. It does not need a
+// window or any other output, so it can be used as a library.
+func New(opts Options) (*Gameboy, error) {
+	rom := opts.ROM
+	if rom == nil {
+		if opts.ROMReader == nil {
+			return nil, errors.New("no rom given")
+		}
+		var err error
+		if rom, err = io.ReadAll(opts.ROMReader); err != nil {
+			return nil, fmt.Errorf("failed to read rom: %w", err)
+		}
+	}
+
+	gameboy := &Gameboy{}
+	if err := gameboy.iniciar(rom, opts.Filename, opts.CGB, opts.RTCEpoch); err != nil {
+		return nil, err
+	}
+	gameboy.EnableRewind(opts.RewindBudget, opts.RewindInterval)
+	gameboy.SetSerialOutput(opts.SerialOutput)
+	return gameboy, nil
+}
+
+// RunFrame runs the emulation for a frame and returns the number of cycles
+// it took.
+func (gb *Gameboy) RunFrame() int {
+	return gb.Update()
+}
+
+// StepInstruction runs a single instruction and returns the number of cycles
+// it took. If the CPU is halted it waits for a single cycle instead.
+func (gb *Gameboy) StepInstruction() int {
+	return gb.step()
+}
+
+// Framebuffer returns a copy of the last frame drawn by the game.
+func (gb *Gameboy) Framebuffer() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, ScreenWidth, ScreenHeight))
+	for x := 0; x < ScreenWidth; x++ {
+		for y := 0; y < ScreenHeight; y++ {
+			col := gb.PreparedData[x][y]
+			i := img.PixOffset(x, y)
+			img.Pix[i] = col[0]
+			img.Pix[i+1] = col[1]
+			img.Pix[i+2] = col[2]
+			img.Pix[i+3] = 0xFF
+		}
+	}
+	return img
+}
+
+// SetButtons sets which of the GameBoy buttons are held down. Bit n of the
+// mask is set if Button n is pressed, so ButtonA is bit 0 and ButtonDown is
+// bit 7. The joypad interrupt is requested if any buttons are newly pressed.
+func (gb *Gameboy) SetButtons(mask byte) {
+	pressed := ^mask
+	if newlyPressed := gb.inputMask &^ pressed; newlyPressed != 0 {
+		gb.requestInterrupt(4)
+	}
+	gb.inputMask = pressed
+}
@@ -1,9 +1,8 @@
 package gb
 
 import (
-	"fmt"
 	"gameboy/bits"
-	"gameboy/logger"
+	"log"
 	_ "sort"
 )
 
@@ -20,7 +19,18 @@ type Z80 struct {
 
 	Divider int
 
-	Memory *Memory
+	// Breakpoint is set when LD B,B is run, which test ROMs such as the
+	// mooneye-test-suite use as a software breakpoint to signal the end of
+	// a test. It stays set until it is cleared.
+	Breakpoint bool
+
+	// Halted is set by HALT and STOP until an interrupt is requested, and
+	// Stopped is set by STOP until the machine has handled it.
+	Halted, Stopped bool
+
+	// Bus is where the CPU reads and writes memory, and which it tells how
+	// many cycles each instruction takes.
+	Bus Bus
 }
 
 func (z *Z80) SpHiLo() uint16 {
@@ -70,7 +80,7 @@ func (z *Z80) setFlagsFromF() {
 	z.setAF()
 }
 
-func (z *Z80) Init(memory *Memory, cgb bool) {
+func (z *Z80) Init(bus Bus, cgb bool) {
 	z.PC = 0x0100
 	z.SP = 0xFFFE
 
@@ -98,21 +108,42 @@ func (z *Z80) Init(memory *Memory, cgb bool) {
 	z.setBC()
 	z.setDE()
 	z.setHL()
-	z.Memory = memory
+	z.Bus = bus
 
 }
 
 func (z *Z80) readMemory(addr uint16) byte {
-	if z.Memory == nil {
-		fmt.Println("Erro: Memória não inicializada")
+	if z.Bus == nil {
 		return 0xFF // Retornar valor padrão em caso de memória não inicializada
 	}
 
-	return z.Memory.ReadByte(addr)
+	return z.Bus.Read(addr)
+}
+
+// fetch reads a byte of an instruction. It is read without being reported
+// as a read if the bus implements fetcher.
+func (z *Z80) fetch(addr uint16) byte {
+	if f, ok := z.Bus.(fetcher); ok {
+		return f.Fetch(addr)
+	}
+	return z.readMemory(addr)
 }
 
 func (z *Z80) readHighRam(addr uint16) byte {
-	return z.Memory.ReadHighRam(addr)
+	return z.Bus.Read(addr)
+}
+
+// readWord reads a little endian word from the bus, low byte first.
+func (z *Z80) readWord(addr uint16) uint16 {
+	low := z.Bus.Read(addr)
+	return uint16(z.Bus.Read(addr+1))<<8 | uint16(low)
+}
+
+// writeWord writes a little endian word to the bus, high byte first like
+// pushing onto the stack.
+func (z *Z80) writeWord(addr uint16, value uint16) {
+	z.Bus.Write(addr+1, byte(value>>8))
+	z.Bus.Write(addr, byte(value))
 }
 
 func (z *Z80) updateFlagsInc(value byte) {
@@ -357,6 +388,7 @@ func (z *Z80) ExecuteInstruction(opcode byte) {
 		z.CCF()
 	case 0x40:
 		z.LD_B_B()
+		z.Breakpoint = true
 	case 0x41:
 		z.LD_B_C()
 	case 0x42:
@@ -725,9 +757,8 @@ func (z *Z80) ExecuteInstruction(opcode byte) {
 		// logger.CloseLogger()
 		// os.Exit(1) // Encerra o programa
 
-		logger.LogMessage(fmt.Sprintf("Opcode não suportado: 0x%X\n", opcode))
-		//fmt.Printf("Opcode não suportado: 0x%X\n", opcode)
-		fmt.Scanln()
+		// Log rather than stop, as the core can run without a terminal
+		log.Printf("Unsupported opcode %#02x at %#04x", opcode, z.PC)
 		// fmt.Printf("Opcode não suportado: 0x%X\n", opcode)
 
 		// logger.LogMessage(fmt.Sprintf("Opcode não suportado: 0x%X\n", opcode))
@@ -740,93 +771,16 @@ func (z *Z80) ExecuteInstruction(opcode byte) {
 	}
 }
 
+// EmulateCycle runs the next instruction, or waits for 4 cycles if the CPU is
+// halted, and ticks the bus by the number of cycles it took.
 func (z *Z80) EmulateCycle() int {
-	opcode := z.readMemory(z.PC)
-	var cb byte
-	if opcode == 0xCB {
-		cb = z.readMemory(z.PC + 1)
+	if z.Halted {
+		z.Bus.Tick(4)
+		return 4
 	}
-	// fmt.Println("\n================ Registros ================")
-	// fmt.Printf("Z: %t | N: %t | HF: %t | CF: %t\n", z.Z, z.N, z.HF, z.CF)
-	// fmt.Printf("PC: 0x%X | SP: 0x%X | LY:  0x%X\n", z.PC, z.SP, z.Memory.Hram[0x44])
-	// fmt.Printf("LCDC: %X | STAT: %X | LYC: %X  IF: 0x%X\n", z.Memory.Hram[0x40], z.Memory.Hram[0x41], z.Memory.Hram[0x45], z.Memory.Hram[0x0F])
-	// fmt.Printf("A:  0x%X | F:  0x%X | AF: 0x%X\n", z.A, z.F, z.AF)
-	// fmt.Printf("B:  0x%X | C:  0x%X | BC: 0x%X\n", z.B, z.C, z.BC)
-	// fmt.Printf("D:  0x%X | E:  0x%X | DE: 0x%X\n", z.D, z.E, z.DE)
-	// fmt.Printf("H:  0x%X | L:  0x%X | HL: 0x%X\n", z.H, z.L, z.HL)
-	// fmt.Printf("0xFF80:  0x%X | 0xFF81:  0x%X | 0xFF82:  0x%X\n", z.Memory.Hram[0x80], z.Memory.Hram[0x81], z.Memory.Hram[0x82])
-	// // fmt.Printf("Scanline:  %d\n", z.Memory.gb.scanlineCounter)
-	// // fmt.Printf("TIMA: %X | TAC: %X  | IE: 0x%X\n", z.Memory.Hram[0x05], z.Memory.Hram[0x07], z.Memory.Hram[0xFF])
-	// // fmt.Printf("IME:  %t\n", z.InterruptsEnabling)
-	// fmt.Printf("NEXT OPCODE:  0x%X%s\n", opcode, fmt.Sprintf(" 0x%X", cb))
-	// fmt.Println("=============================================")
-
-	// fmt.Printf(`
-	// 	================ Registros ================
-	// 	Z: %t | N: %t | HF: %t | CF: %t
-	// 	PC: 0x%X | SP: 0x%X | LY:  0x%X
-	// 	LCDC: %X | STAT: %X | LYC: %X  IF: 0x%X
-	// 	A:  0x%X | F:  0x%X | AF: 0x%X
-	// 	B:  0x%X | C:  0x%X | BC: 0x%X
-	// 	D:  0x%X | E:  0x%X | DE: 0x%X
-	// 	H:  0x%X | L:  0x%X | HL: 0x%X
-	// 	0xFF80:  0x%X | 0xFF81:  0x%X | 0xFF82:  0x%X
-	// 	NEXT OPCODE:  0x%X%s
-	// 	=============================================
-	// 	`,
-	// 	z.Z, z.N, z.HF, z.CF,
-	// 	z.PC, z.SP, z.Memory.Hram[0x44],
-	// 	z.Memory.Hram[0x40], z.Memory.Hram[0x41], z.Memory.Hram[0x45], z.Memory.Hram[0x0F],
-	// 	z.A, z.F, z.AF,
-	// 	z.B, z.C, z.BC,
-	// 	z.D, z.E, z.DE,
-	// 	z.H, z.L, z.HL,
-	// 	z.Memory.Hram[0x80], z.Memory.Hram[0x81], z.Memory.Hram[0x82],
-	// 	opcode, fmt.Sprintf(" 0x%X", cb),
-	// )
-
-	logger.LogMessage(fmt.Sprintf(`
-================ Registros ================
-Z: %t | N: %t | HF: %t | CF: %t
-PC: 0x%X | SP: 0x%X | LY:  0x%X
-LCDC: %X | STAT: %X | LYC: %X  IF: 0x%X
-A:  0x%X | F:  0x%X | AF: 0x%X
-B:  0x%X | C:  0x%X | BC: 0x%X
-D:  0x%X | E:  0x%X | DE: 0x%X
-H:  0x%X | L:  0x%X | HL: 0x%X
-0xFF80:  0x%X | 0xFF81:  0x%X | 0xFF82:  0x%X
-NEXT OPCODE:  0x%X%s
-=============================================
-			`,
-		z.Z, z.N, z.HF, z.CF,
-		z.PC, z.SP, z.Memory.Hram[0x44],
-		z.Memory.Hram[0x40], z.Memory.Hram[0x41], z.Memory.Hram[0x45], z.Memory.Hram[0x0F],
-		z.A, z.F, z.AF,
-		z.B, z.C, z.BC,
-		z.D, z.E, z.DE,
-		z.H, z.L, z.HL,
-		z.Memory.Hram[0x80], z.Memory.Hram[0x81], z.Memory.Hram[0x82],
-		opcode,
-		fmt.Sprintf(" 0x%X", cb),
-	))
-
-	// logger.LogMessage("\n================ Registros ================")
-	// logger.LogMessage(fmt.Sprintf("Z: %t | N: %t | HF: %t | CF: %t", z.Z, z.N, z.HF, z.CF))
-	// logger.LogMessage(fmt.Sprintf("PC: 0x%X | SP: 0x%X | LY:  0x%X", z.PC, z.SP, z.Memory.Hram[0x44]))
-	// logger.LogMessage(fmt.Sprintf("LCDC: %X | STAT: %X | LYC: %X  IF: 0x%X", z.Memory.Hram[0x40], z.Memory.Hram[0x41], z.Memory.Hram[0x45], z.Memory.Hram[0x0F]))
-	// logger.LogMessage(fmt.Sprintf("A:  0x%X | F:  0x%X | AF: 0x%X", z.A, z.F, z.AF))
-	// logger.LogMessage(fmt.Sprintf("B:  0x%X | C:  0x%X | BC: 0x%X", z.B, z.C, z.BC))
-	// logger.LogMessage(fmt.Sprintf("D:  0x%X | E:  0x%X | DE: 0x%X", z.D, z.E, z.DE))
-	// logger.LogMessage(fmt.Sprintf("H:  0x%X | L:  0x%X | HL: 0x%X", z.H, z.L, z.HL))
-	// logger.LogMessage(fmt.Sprintf("0xFF80:  0x%X | 0xFF81:  0x%X | 0xFF82:  0x%X", z.Memory.Hram[0x80], z.Memory.Hram[0x81], z.Memory.Hram[0x82]))
-	// logger.LogMessage(fmt.Sprintf("NEXT OPCODE:  0x%X", opcode))
-	// logger.LogMessage("=============================================")
-
-	// if z.PC == 0xC428 {
-	// 	fmt.Println("---------------------------0x30---------------------------")
-	// 	fmt.Scanln()
-	// }
+	opcode := z.fetch(z.PC)
 	z.ExecuteInstruction(opcode)
+	z.Bus.Tick(z.M)
 
 	return z.M
 }
@@ -0,0 +1,677 @@
+package gb
+
+import (
+	"errors"
+	"fmt"
+	"gameboy/bits"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// AnyBank is the bank of a Location which matches the address in any bank.
+const AnyBank = -1
+
+// Location is an address in one of the banks of memory, such as a routine in
+// a switchable ROM bank.
+type Location struct {
+	Bank    int
+	Address uint16
+}
+
+// ParseLocation parses a hexadecimal address such as "4A10", or an address in
+// a bank such as "03:4A10".
+func ParseLocation(s string) (Location, error) {
+	loc := Location{Bank: AnyBank}
+	if bank, address, ok := strings.Cut(s, ":"); ok {
+		b, err := parseHex(bank, 0xFFFF)
+		if err != nil {
+			return loc, fmt.Errorf("invalid bank %q", bank)
+		}
+		loc.Bank = int(b)
+		s = address
+	}
+	address, err := parseHex(s, 0xFFFF)
+	if err != nil {
+		return loc, fmt.Errorf("invalid address %q", s)
+	}
+	loc.Address = address
+	return loc, nil
+}
+
+func (l Location) String() string {
+	if l.Bank == AnyBank {
+		return fmt.Sprintf("%04X", l.Address)
+	}
+	return fmt.Sprintf("%02X:%04X", l.Bank, l.Address)
+}
+
+// parseHex parses a hexadecimal number, which can start with "0x" or "$",
+// and checks it is no more than max.
+func parseHex(s string, max uint16) (uint16, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "0x"), "$")
+	value, err := strconv.ParseUint(s, 16, 16)
+	if err != nil || uint16(value) > max {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return uint16(value), nil
+}
+
+// Bank returns the number of the bank which is mapped at an address, which
+// is 0 for the parts of memory which can not be switched.
+func (gb *Gameboy) Bank(address uint16) int {
+	switch {
+	case address >= 0x4000 && address < 0x8000:
+		return gb.Memory.Cart.ROMBank()
+	case address >= 0x8000 && address < 0xA000:
+		return int(gb.Memory.VramBank)
+	case address >= 0xD000 && address < 0xE000:
+		return int(gb.Memory.WramBank)
+	default:
+		return 0
+	}
+}
+
+// at returns if the location is mapped in at the address.
+func (gb *Gameboy) at(l Location, address uint16) bool {
+	return l.Address == address && (l.Bank == AnyBank || l.Bank == gb.Bank(address))
+}
+
+// Condition compares the value of one of the CPU registers, such as
+// "A == 10" or "HL >= C000".
+type Condition struct {
+	Register string
+	Op       string
+	Value    uint16
+}
+
+var conditionOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// ParseCondition parses a comparison of a register with a hexadecimal value.
+// The registers are A, F, B, C, D, E, H, L, AF, BC, DE, HL, SP and PC.
+func ParseCondition(s string) (*Condition, error) {
+	for _, op := range conditionOps {
+		register, value, ok := strings.Cut(s, op)
+		if !ok {
+			continue
+		}
+		c := &Condition{
+			Register: strings.ToUpper(strings.TrimSpace(register)),
+			Op:       op,
+		}
+		if _, ok := (&Z80{}).Register(c.Register); !ok {
+			return nil, fmt.Errorf("unknown register %q", c.Register)
+		}
+		v, err := parseHex(strings.TrimSpace(value), 0xFFFF)
+		if err != nil {
+			return nil, err
+		}
+		c.Value = v
+		return c, nil
+	}
+	return nil, fmt.Errorf("invalid condition %q, expected a comparison such as A == 10", s)
+}
+
+func (c *Condition) String() string {
+	return fmt.Sprintf("%s %s %X", c.Register, c.Op, c.Value)
+}
+
+// eval returns if the condition is true for the current registers.
+func (c *Condition) eval(z *Z80) bool {
+	value, _ := z.Register(c.Register)
+	switch c.Op {
+	case "==":
+		return value == c.Value
+	case "!=":
+		return value != c.Value
+	case "<=":
+		return value <= c.Value
+	case ">=":
+		return value >= c.Value
+	case "<":
+		return value < c.Value
+	default:
+		return value > c.Value
+	}
+}
+
+// Register returns the value of a register by its name.
+func (z *Z80) Register(name string) (uint16, bool) {
+	switch name {
+	case "A":
+		return uint16(z.A), true
+	case "F":
+		return uint16(z.F), true
+	case "B":
+		return uint16(z.B), true
+	case "C":
+		return uint16(z.C), true
+	case "D":
+		return uint16(z.D), true
+	case "E":
+		return uint16(z.E), true
+	case "H":
+		return uint16(z.H), true
+	case "L":
+		return uint16(z.L), true
+	case "AF":
+		return uint16(z.A)<<8 | uint16(z.F), true
+	case "BC":
+		return uint16(z.B)<<8 | uint16(z.C), true
+	case "DE":
+		return uint16(z.D)<<8 | uint16(z.E), true
+	case "HL":
+		return uint16(z.H)<<8 | uint16(z.L), true
+	case "SP":
+		return z.SP, true
+	case "PC":
+		return z.PC, true
+	}
+	return 0, false
+}
+
+// SetRegister sets the value of a register by its name, and returns false if
+// there is no register with the name.
+func (z *Z80) SetRegister(name string, value uint16) bool {
+	high, low := byte(value>>8), byte(value)
+	switch name {
+	case "A":
+		z.A = low
+	case "F":
+		z.F = low & 0xF0
+	case "B":
+		z.B = low
+	case "C":
+		z.C = low
+	case "D":
+		z.D = low
+	case "E":
+		z.E = low
+	case "H":
+		z.H = low
+	case "L":
+		z.L = low
+	case "AF":
+		z.A, z.F = high, low&0xF0
+	case "BC":
+		z.B, z.C = high, low
+	case "DE":
+		z.D, z.E = high, low
+	case "HL":
+		z.H, z.L = high, low
+	case "SP":
+		z.SP = value
+	case "PC":
+		z.PC = value
+	default:
+		return false
+	}
+	z.setFlagsFromF()
+	z.setBC()
+	z.setDE()
+	z.setHL()
+	return true
+}
+
+// Breakpoint stops the execution before the instruction at a location, and
+// only if its condition is true when it has one. A breakpoint without a
+// location stops wherever its condition becomes true.
+type Breakpoint struct {
+	ID        int
+	Location  *Location
+	Condition *Condition
+	Hits      int
+
+	// If the condition of a breakpoint without a location was true at the
+	// last instruction.
+	active bool
+}
+
+func (b *Breakpoint) String() string {
+	switch {
+	case b.Location == nil:
+		return fmt.Sprintf("when %v", b.Condition)
+	case b.Condition == nil:
+		return fmt.Sprintf("at %v", b.Location)
+	default:
+		return fmt.Sprintf("at %v if %v", b.Location, b.Condition)
+	}
+}
+
+// WatchKind is the kinds of access to memory a watchpoint stops on.
+type WatchKind byte
+
+const (
+	WatchRead WatchKind = 1 << iota
+	WatchWrite
+	WatchExecute
+)
+
+func (k WatchKind) String() string {
+	s := ""
+	if k&WatchRead != 0 {
+		s += "r"
+	}
+	if k&WatchWrite != 0 {
+		s += "w"
+	}
+	if k&WatchExecute != 0 {
+		s += "x"
+	}
+	return s
+}
+
+// Watchpoint stops the execution when the CPU accesses an address in a range
+// of memory.
+type Watchpoint struct {
+	ID         int
+	Start, End uint16
+	Kind       WatchKind
+	Hits       int
+}
+
+func (w *Watchpoint) String() string {
+	if w.Start == w.End {
+		return fmt.Sprintf("%v on %04X", w.Kind, w.Start)
+	}
+	return fmt.Sprintf("%v on %04X-%04X", w.Kind, w.Start, w.End)
+}
+
+func (w *Watchpoint) contains(address uint16) bool {
+	return address >= w.Start && address <= w.End
+}
+
+// StopReason is why the execution stopped.
+type StopReason int
+
+const (
+	// StopDone is when a step or run to a frame or scanline finished.
+	StopDone StopReason = iota
+	StopBreakpoint
+	StopWatchpoint
+	// StopInterrupted is when the execution was stopped by Interrupt.
+	StopInterrupted
+)
+
+// Stop describes where and why the execution stopped.
+type Stop struct {
+	Reason StopReason
+	// The breakpoint or watchpoint which was hit.
+	ID int
+	// The address of the next instruction, or the address which was
+	// accessed for a watchpoint.
+	Address uint16
+	// The access which hit the watchpoint, and the value read or written.
+	Kind  WatchKind
+	Value byte
+}
+
+func (s Stop) String() string {
+	switch s.Reason {
+	case StopBreakpoint:
+		return fmt.Sprintf("breakpoint %d at %04X", s.ID, s.Address)
+	case StopWatchpoint:
+		switch s.Kind {
+		case WatchRead:
+			return fmt.Sprintf("watchpoint %d: read %02X from %04X", s.ID, s.Value, s.Address)
+		case WatchWrite:
+			return fmt.Sprintf("watchpoint %d: write %02X to %04X", s.ID, s.Value, s.Address)
+		default:
+			return fmt.Sprintf("watchpoint %d: execute at %04X", s.ID, s.Address)
+		}
+	case StopInterrupted:
+		return fmt.Sprintf("interrupted at %04X", s.Address)
+	default:
+		return fmt.Sprintf("stopped at %04X", s.Address)
+	}
+}
+
+// Frame is a subroutine call or interrupt on the call stack.
+type Frame struct {
+	// The address of the call instruction, or of the instruction which
+	// was interrupted, and the bank it is in.
+	Caller     uint16
+	CallerBank int
+	// The address which was called and the bank it is in.
+	Target     uint16
+	TargetBank int
+	Interrupt  bool
+
+	// The stack pointer after the return address was pushed, which is
+	// used to find when the call returns.
+	sp uint16
+}
+
+// Debugger controls the execution of the machine one instruction at a time,
+// stopping it at breakpoints and watchpoints.
+type Debugger struct {
+	gb *Gameboy
+
+	nextID      int
+	breakpoints []*Breakpoint
+	watchpoints []*Watchpoint
+
+	// The first watchpoint hit by the current instruction.
+	hit *Stop
+	// The opcode and cycles of the last instruction run.
+	lastOpcode byte
+	lastCycles int
+	// Cycles since the last audio was collected.
+	frameCycles int
+	// The calls made since the debugger was attached which have not
+	// returned, with the innermost last.
+	callStack []Frame
+
+	interrupted atomic.Bool
+}
+
+// Debugger returns the debugger of the machine, attaching one the first time
+// it is called. Watchpoints slow down every memory access of the CPU, so it
+// should only be attached when it is going to be used.
+func (gb *Gameboy) Debugger() *Debugger {
+	if gb.debugger == nil {
+		gb.debugger = &Debugger{gb: gb, nextID: 1}
+	}
+	return gb.debugger
+}
+
+// AddBreakpoint adds a breakpoint at a location, with an optional condition,
+// or one which stops when a condition becomes true if loc is nil. It returns
+// the ID of the breakpoint.
+func (d *Debugger) AddBreakpoint(loc *Location, cond *Condition) (int, error) {
+	if loc == nil && cond == nil {
+		return 0, errors.New("a breakpoint needs a location or a condition")
+	}
+	b := &Breakpoint{ID: d.nextID, Location: loc, Condition: cond}
+	if loc == nil {
+		b.active = cond.eval(d.gb.CPU)
+	}
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, b)
+	return b.ID, nil
+}
+
+// AddWatchpoint adds a watchpoint on the addresses from start to end
+// inclusive. It returns the ID of the watchpoint.
+func (d *Debugger) AddWatchpoint(start, end uint16, kind WatchKind) (int, error) {
+	if end < start {
+		return 0, fmt.Errorf("invalid range %04X-%04X", start, end)
+	}
+	if kind == 0 {
+		return 0, errors.New("a watchpoint needs a kind of access")
+	}
+	w := &Watchpoint{ID: d.nextID, Start: start, End: end, Kind: kind}
+	d.nextID++
+	d.watchpoints = append(d.watchpoints, w)
+	return w.ID, nil
+}
+
+// Delete removes a breakpoint or watchpoint.
+func (d *Debugger) Delete(id int) error {
+	for i, b := range d.breakpoints {
+		if b.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+	for i, w := range d.watchpoints {
+		if w.ID == id {
+			d.watchpoints = append(d.watchpoints[:i], d.watchpoints[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint or watchpoint %d", id)
+}
+
+// Breakpoints returns the breakpoints in the order they were added.
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	return d.breakpoints
+}
+
+// Watchpoints returns the watchpoints in the order they were added.
+func (d *Debugger) Watchpoints() []*Watchpoint {
+	return d.watchpoints
+}
+
+// CallStack returns the calls which have not returned, innermost first. Only
+// the calls made while the debugger has been running the machine are known.
+func (d *Debugger) CallStack() []Frame {
+	frames := make([]Frame, len(d.callStack))
+	for i, f := range d.callStack {
+		frames[len(frames)-1-i] = f
+	}
+	return frames
+}
+
+// Interrupt stops the current run at the next instruction. It can be called
+// from another goroutine.
+func (d *Debugger) Interrupt() {
+	d.interrupted.Store(true)
+}
+
+// Step runs a single instruction. If the CPU is halted it waits until it
+// wakes up, for up to a frame.
+func (d *Debugger) Step() Stop {
+	cycles := 0
+	return d.run(func() bool {
+		cycles += d.lastCycles
+		return !d.gb.CPU.Halted || cycles >= CyclesFrame*d.gb.getSpeed()
+	})
+}
+
+// StepOver runs a single instruction, or the whole of a subroutine if the
+// instruction calls one.
+func (d *Debugger) StepOver() Stop {
+	pc, sp := d.gb.CPU.PC, d.gb.CPU.SP
+	length := callLength(d.gb.Memory.ReadByte(pc))
+	if d.gb.CPU.Halted || length == 0 {
+		return d.Step()
+	}
+	next := pc + length
+	return d.run(func() bool {
+		return d.gb.CPU.PC == next && d.gb.CPU.SP >= sp
+	})
+}
+
+// StepOut runs until the current subroutine returns.
+func (d *Debugger) StepOut() Stop {
+	sp := d.gb.CPU.SP
+	return d.run(func() bool {
+		return isReturn(d.lastOpcode) && d.gb.CPU.SP > sp
+	})
+}
+
+// Continue runs until a breakpoint or watchpoint is hit, or Interrupt is
+// called.
+func (d *Debugger) Continue() Stop {
+	return d.run(func() bool { return false })
+}
+
+// RunFrames runs until the start of the vertical blank of the nth frame.
+// While the screen is off a frame is counted every CyclesFrame cycles.
+func (d *Debugger) RunFrames(n int) Stop {
+	frames, cycles := 0, 0
+	line := d.gb.Memory.Hram[0x44]
+	return d.run(func() bool {
+		cycles += d.lastCycles
+		previous := line
+		line = d.gb.Memory.Hram[0x44]
+		lcdOff := !bits.Test(d.gb.Memory.Hram[0x40], 7)
+		if (line == 144 && previous != 144) || (lcdOff && cycles >= CyclesFrame*d.gb.getSpeed()) {
+			frames++
+			cycles = 0
+		}
+		return frames >= n
+	})
+}
+
+// RunToScanline runs until the PPU starts drawing a scanline (0-153).
+func (d *Debugger) RunToScanline(target int) Stop {
+	line := d.gb.Memory.Hram[0x44]
+	return d.run(func() bool {
+		previous := line
+		line = d.gb.Memory.Hram[0x44]
+		return int(line) == target && line != previous
+	})
+}
+
+// run steps the machine until done returns true after an instruction, or a
+// breakpoint or watchpoint is hit. Breakpoints at the first instruction are
+// ignored, so a run can continue from one.
+func (d *Debugger) run(done func() bool) Stop {
+	d.interrupted.Store(false)
+	for first := true; ; first = false {
+		if !first {
+			if stop := d.checkBreakpoints(); stop != nil {
+				return *stop
+			}
+		}
+		if d.interrupted.Swap(false) {
+			return Stop{Reason: StopInterrupted, Address: d.gb.CPU.PC}
+		}
+		d.step()
+		if d.hit != nil {
+			return *d.hit
+		}
+		if done() {
+			return Stop{Reason: StopDone, Address: d.gb.CPU.PC}
+		}
+	}
+}
+
+// step runs a single step of the machine, and collects the sound every frame
+// so it does not build up.
+func (d *Debugger) step() {
+	d.hit = nil
+	pc, sp := d.gb.CPU.PC, d.gb.CPU.SP
+	bank := d.gb.Bank(pc)
+	halted := d.gb.CPU.Halted
+	d.lastOpcode = d.gb.Memory.ReadByte(pc)
+	d.lastCycles = d.gb.step()
+	if halted {
+		// No instruction was run
+		d.updateCallStack(pc, bank, sp, 0)
+	} else {
+		d.updateCallStack(pc, bank, sp, d.lastOpcode)
+	}
+	d.frameCycles += d.lastCycles
+	if d.frameCycles >= CyclesFrame*d.gb.getSpeed() {
+		d.frameCycles = 0
+		d.gb.collectAudio()
+	}
+}
+
+// updateCallStack adds the calls and interrupts made by the last step, and
+// removes the frames which have returned.
+func (d *Debugger) updateCallStack(pc uint16, bank int, sp uint16, opcode byte) {
+	cpu := d.gb.CPU
+	for n := len(d.callStack); n > 0 && cpu.SP > d.callStack[n-1].sp; n-- {
+		d.callStack = d.callStack[:n-1]
+	}
+	if cpu.SP >= sp {
+		return
+	}
+
+	if length := callLength(opcode); length > 0 {
+		target := uint16(opcode & 0x38)
+		if length == 3 {
+			target = d.gb.Memory.ReadWord(pc + 1)
+		}
+		// The call was made if it jumped to the target, or if an
+		// interrupt was also taken after it
+		if cpu.PC == target || cpu.SP == sp-4 {
+			sp -= 2
+			d.callStack = append(d.callStack, Frame{
+				Caller:     pc,
+				CallerBank: bank,
+				Target:     target,
+				TargetBank: d.gb.Bank(target),
+				sp:         sp,
+			})
+		}
+	}
+	if cpu.SP == sp-2 && cpu.PC >= 0x40 && cpu.PC <= 0x60 && cpu.PC%8 == 0 {
+		caller := d.gb.Memory.ReadWord(cpu.SP)
+		d.callStack = append(d.callStack, Frame{
+			Caller:     caller,
+			CallerBank: d.gb.Bank(caller),
+			Target:     cpu.PC,
+			Interrupt:  true,
+			sp:         cpu.SP,
+		})
+	}
+}
+
+// checkBreakpoints returns where the execution should stop before the next
+// instruction is run, or nil if it should carry on.
+func (d *Debugger) checkBreakpoints() *Stop {
+	if d.gb.CPU.Halted {
+		return nil
+	}
+	pc := d.gb.CPU.PC
+	var stop *Stop
+	for _, b := range d.breakpoints {
+		if b.Location == nil {
+			// Only stop when the condition changes to true, so running
+			// on does not stop again straight away.
+			wasActive := b.active
+			b.active = b.Condition.eval(d.gb.CPU)
+			if !b.active || wasActive || stop != nil {
+				continue
+			}
+		} else if !d.gb.at(*b.Location, pc) || (b.Condition != nil && !b.Condition.eval(d.gb.CPU)) {
+			continue
+		}
+		if stop == nil {
+			b.Hits++
+			stop = &Stop{Reason: StopBreakpoint, ID: b.ID, Address: pc}
+		}
+	}
+	if stop != nil {
+		return stop
+	}
+	for _, w := range d.watchpoints {
+		if w.Kind&WatchExecute != 0 && w.contains(pc) {
+			w.Hits++
+			return &Stop{Reason: StopWatchpoint, ID: w.ID, Address: pc, Kind: WatchExecute}
+		}
+	}
+	return nil
+}
+
+// access is called by the memory on each read and write by the CPU while
+// the debugger is attached.
+func (d *Debugger) access(address uint16, value byte, kind WatchKind) {
+	if d.hit != nil {
+		return
+	}
+	for _, w := range d.watchpoints {
+		if w.Kind&kind != 0 && w.contains(address) {
+			w.Hits++
+			d.hit = &Stop{Reason: StopWatchpoint, ID: w.ID, Address: address, Kind: kind, Value: value}
+			return
+		}
+	}
+}
+
+// callLength returns the length of a CALL or RST instruction, or 0 if the
+// opcode is not one.
+func callLength(opcode byte) uint16 {
+	switch {
+	case opcode == 0xCD || opcode == 0xC4 || opcode == 0xCC || opcode == 0xD4 || opcode == 0xDC:
+		return 3
+	case opcode&0xC7 == 0xC7:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// isReturn returns if the opcode is one of the RET instructions.
+func isReturn(opcode byte) bool {
+	switch opcode {
+	case 0xC9, 0xD9, 0xC0, 0xC8, 0xD0, 0xD8:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package gb
+
+import "testing"
+
+func TestReadWatchpointIgnoresFetches(t *testing.T) {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x100:], []byte{
+		0xFA, 0x50, 0x01, // 0100 ld a, [$0150]
+		0x00, //             0103 nop
+	})
+	gameboy, err := New(Options{ROM: rom})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := gameboy.Debugger()
+	if _, err := d.AddWatchpoint(0x0100, 0x0102, WatchRead); err != nil {
+		t.Fatal(err)
+	}
+	data, err := d.AddWatchpoint(0x0150, 0x0150, WatchRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	execute, err := d.AddWatchpoint(0x0104, 0x0104, WatchExecute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Stop{Reason: StopWatchpoint, ID: data, Address: 0x0150, Kind: WatchRead}
+	if stop := d.Step(); stop != want {
+		t.Errorf("got %v, want %v", stop, want)
+	}
+	want = Stop{Reason: StopWatchpoint, ID: execute, Address: 0x0104, Kind: WatchExecute}
+	if stop := d.Continue(); stop != want {
+		t.Errorf("got %v, want %v", stop, want)
+	}
+}
@@ -2,9 +2,12 @@ package gb
 
 import (
 	"fmt"
+	"gameboy/apu"
+	"gameboy/audio"
 	"gameboy/bits"
-
-	_ "github.com/faiface/pixel/pixelgl"
+	"io"
+	"os"
+	"time"
 )
 
 const (
@@ -22,7 +25,7 @@ const (
 type Gameboy struct {
 	Memory *Memory
 	CPU    *Z80
-	//Sound  *apu.APU
+	Sound  *apu.APU
 
 	timerCounter int
 
@@ -38,8 +41,6 @@ type Gameboy struct {
 
 	PreparedData [ScreenWidth][ScreenHeight][3]uint8
 
-	halted bool
-
 	// Mask of the currently pressed buttons.
 	inputMask byte
 
@@ -52,6 +53,26 @@ type Gameboy struct {
 	currentSpeed byte
 	prepareSpeed bool
 
+	// Sound generated during the last frame, and the recording it is
+	// written to if one has been started.
+	audioFrame    []int16
+	audioRecorder *audio.Recorder
+
+	// Snapshots to rewind to, which is nil if rewinding is off, and if the
+	// rewind button is being held.
+	rewind    *rewindBuffer
+	rewinding bool
+
+	// Where the bytes sent over the link cable are written, if anywhere.
+	serialOutput io.Writer
+
+	// The debugger, which is nil until one is attached.
+	debugger *Debugger
+
+	// The trace of the instructions run, which is nil unless one has been
+	// started.
+	trace *tracer
+
 	keyHandlers map[Button]func()
 }
 
@@ -86,8 +107,8 @@ func (gb *Gameboy) IsGameLoaded() bool {
 }
 
 func (gb *Gameboy) pushStack(addr uint16) {
-	gb.Memory.WriteByte(gb.CPU.SP-1, byte(uint16(addr&0xFF00)>>8))
-	gb.Memory.WriteByte(gb.CPU.SP-2, byte(addr&0xFF))
+	gb.CPU.Bus.Write(gb.CPU.SP-1, byte(uint16(addr&0xFF00)>>8))
+	gb.CPU.Bus.Write(gb.CPU.SP-2, byte(addr&0xFF))
 
 	gb.CPU.SP -= 2
 }
@@ -101,7 +122,7 @@ func (gb *Gameboy) checkSpeedSwitch() {
 		} else {
 			gb.currentSpeed = 0
 		}
-		gb.halted = false
+		gb.CPU.Halted = false
 	}
 }
 
@@ -118,25 +139,54 @@ func (gb *Gameboy) BGMapString() string {
 }
 
 func (gb *Gameboy) Update() int {
+	if gb.rewinding {
+		gb.Rewind(1)
+		gb.audioFrame = nil
+		return 0
+	}
+
+	cycles := gb.runFrame()
+	gb.collectAudio()
+	gb.snapshotRewind()
+
+	return cycles
+}
+
+// runFrame runs the machine for a frame and returns the number of cycles
+// it took.
+func (gb *Gameboy) runFrame() int {
 	cycles := 0
 	//targetCycles := CyclesFrame * gb.getSpeed()
 
 	//for cycles+4 < CyclesFrame*gb.getSpeed() {
 	for cycles < CyclesFrame*gb.getSpeed() {
-		cyclesOp := 4
-		if !gb.halted {
-			cyclesOp = gb.CPU.EmulateCycle()
-		}
-
-		// Atualiza gráficos e timers com o número correto de ciclos
-		gb.updateGraphics(cyclesOp)
-		gb.updateTimers(cyclesOp)
-		cycles += cyclesOp
-		cycles += gb.doInterrupts()
+		cycles += gb.step()
+	}
+	return cycles
+}
 
-		//gb.Sound.Buffer(cyclesOp, gb.getSpeed())
+// step runs a single instruction, or a cycle of waiting if the CPU is
+// halted, and the rest of the hardware for the time it took. It returns the
+// number of cycles run.
+func (gb *Gameboy) step() int {
+	if !gb.CPU.Halted && gb.trace != nil {
+		gb.trace.instruction(gb)
+	}
+	// The CPU ticks the rest of the machine through the bus
+	gb.Memory.watching = gb.debugger != nil
+	cycles := gb.CPU.EmulateCycle()
+	gb.Memory.watching = false
+	if gb.CPU.Stopped {
+		gb.CPU.Stopped = false
+		if gb.IsCGB() {
+			gb.checkSpeedSwitch()
+		}
 	}
+	cycles += gb.doInterrupts()
 
+	if gb.trace != nil {
+		gb.trace.cycles += uint64(cycles)
+	}
 	return cycles
 }
 
@@ -159,9 +209,15 @@ func (gb *Gameboy) updateTimers(cycles int) {
 	}
 }
 
-// func (gb *Gameboy) ToggleSoundChannel(channel int) {
-// 	gb.Sound.ToggleSoundChannel(channel)
-// }
+// ToggleSoundChannel mutes or unmutes one of the sound channels (1-4).
+func (gb *Gameboy) ToggleSoundChannel(channel int) {
+	gb.Sound.ToggleSoundChannel(channel)
+}
+
+// SetChannelEnabled sets if one of the sound channels (1-4) can be heard.
+func (gb *Gameboy) SetChannelEnabled(channel int, on bool) {
+	gb.Sound.SetChannelEnabled(channel, on)
+}
 
 func (gb *Gameboy) isClockEnabled() bool {
 	return bits.Test(gb.Memory.Hram[0x07] /* TAC */, 2)
@@ -209,7 +265,7 @@ func (gb *Gameboy) doInterrupts() (cycles int) {
 		gb.CPU.InterruptsEnabling = false
 		return 0
 	}
-	if !gb.CPU.IME && !gb.halted {
+	if !gb.CPU.IME && !gb.CPU.Halted {
 		return 0
 	}
 
@@ -220,7 +276,10 @@ func (gb *Gameboy) doInterrupts() (cycles int) {
 		var i byte
 		for i = 0; i < 5; i++ {
 			if bits.Test(req, i) && bits.Test(enabled, i) {
+				// Like the instructions, dispatching the interrupt
+				// ticks the rest of the machine through the bus
 				gb.serviceInterrupt(i)
+				gb.CPU.Bus.Tick(20)
 				return 20
 			}
 		}
@@ -230,16 +289,16 @@ func (gb *Gameboy) doInterrupts() (cycles int) {
 
 func (gb *Gameboy) serviceInterrupt(interrupt byte) {
 	// If was halted without interrupts, do not jump or reset IF
-	if !gb.CPU.IME && gb.halted {
-		gb.halted = false
+	if !gb.CPU.IME && gb.CPU.Halted {
+		gb.CPU.Halted = false
 		return
 	}
 	gb.CPU.IME = false
-	gb.halted = false
+	gb.CPU.Halted = false
 
 	req := gb.Memory.ReadHighRam(0xFF0F)
 	req = bits.Reset(req, interrupt)
-	gb.Memory.WriteByte(0xFF0F, req)
+	gb.CPU.Bus.Write(0xFF0F, req)
 
 	gb.pushStack(gb.CPU.PC)
 	gb.CPU.PC = interruptAddresses[interrupt]
@@ -253,17 +312,18 @@ var interruptAddresses = map[byte]uint16{
 	4: 0x60, // Hi-Lo P10-P13
 }
 
-func (gb *Gameboy) iniciar(romFile string, isCBG bool) error {
+func (gb *Gameboy) iniciar(rom []byte, romFile string, isCBG bool, rtcEpoch *time.Time) error {
 	gb.setup(isCBG)
 
-	// Load the ROM file
-	hasCGB, err := gb.Memory.LoadCart(romFile)
+	// Load the ROM
+	hasCGB, err := gb.Memory.LoadCart(rom, romFile, rtcEpoch)
 	if err != nil {
-		return fmt.Errorf("failed to open rom file: %w", err)
+		return fmt.Errorf("failed to load rom: %w", err)
 	}
 	// gb.cgbMode = false && hasCGB
 
 	gb.cgbMode = isCBG && hasCGB
+	gb.Sound.Init(gb.cgbMode)
 
 	return nil
 }
@@ -276,10 +336,17 @@ func (gb *Gameboy) initKeyHandlers() {
 		//ButtonToggleSprites:       gb.Debug.toggleSprites,
 		//ButttonToggleOutputOpCode: gb.Debug.toggleOutputOpCode,
 		//ButtonPrintBGMap:          gb.printBGMap,
-		// ButtonToggleSoundChannel1: func() { gb.ToggleSoundChannel(1) },
-		// ButtonToggleSoundChannel2: func() { gb.ToggleSoundChannel(2) },
-		// ButtonToggleSoundChannel3: func() { gb.ToggleSoundChannel(3) },
-		// ButtonToggleSoundChannel4: func() { gb.ToggleSoundChannel(4) },
+		ButtonToggleSoundChannel1: func() { gb.ToggleSoundChannel(1) },
+		ButtonToggleSoundChannel2: func() { gb.ToggleSoundChannel(2) },
+		ButtonToggleSoundChannel3: func() { gb.ToggleSoundChannel(3) },
+		ButtonToggleSoundChannel4: func() { gb.ToggleSoundChannel(4) },
+
+		ButtonToggleAudioRecording: gb.toggleAudioRecording,
+		ButtonRewind:               func() { gb.setRewinding(true) },
+	}
+	for i := 0; i < SlotCount; i++ {
+		gb.keyHandlers[ButtonSaveState+Button(i)] = gb.saveSlotHandler(i + 1)
+		gb.keyHandlers[ButtonLoadState+Button(i)] = gb.loadSlotHandler(i + 1)
 	}
 }
 
@@ -293,8 +360,7 @@ func (gb *Gameboy) setup(isCBG bool) {
 	gb.CPU = &Z80{}
 	gb.CPU.Init(gb.Memory, isCBG)
 
-	// gb.Sound = &apu.APU{}
-	// gb.Sound.Init(true)
+	gb.Sound = &apu.APU{}
 
 	gb.scanlineCounter = 456
 	gb.inputMask = 0xFF
@@ -316,20 +382,13 @@ func (gb *Gameboy) setup(isCBG bool) {
 // }
 
 func NewGameboy(romFile string, isCBG bool) (*Gameboy, error) {
-	// Criar uma única instância de Memory
-	memory := &Memory{}
-
-	// Criar a instância do Gameboy e associar a mesma memória
-	gameboy := &Gameboy{
-		Memory: memory,
-		CPU: &Z80{
-			Memory: memory, // CPU usa a mesma instância de Memory
-		},
-	}
-
-	err := gameboy.iniciar(romFile, isCBG)
+	rom, err := os.ReadFile(romFile)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to open rom file: %w", err)
 	}
-	return gameboy, nil
+	return New(Options{
+		ROM:      rom,
+		Filename: romFile,
+		CGB:      isCBG,
+	})
 }
@@ -20,6 +20,16 @@ type IOBinding interface {
 	RenderMemory(gb *Gameboy)
 }
 
+// AudioBinding is an output for the sound generated by the APU.
+type AudioBinding interface {
+	// Play queues a batch of interleaved stereo samples, generated at
+	// apu.SampleRate, to be output.
+	Play(samples []int16)
+
+	// Close flushes any queued audio and releases the output.
+	Close() error
+}
+
 const (
 	// ButtonA is the A button on the GameBoy.
 	ButtonA Button = 0
@@ -48,6 +58,17 @@ const (
 	ButtonToggleSoundChannel2 = 15
 	ButtonToggleSoundChannel3 = 16
 	ButtonToggleSoundChannel4 = 17
+
+	ButtonToggleAudioRecording = 18
+
+	// ButtonSaveState and ButtonLoadState are the first of SlotCount
+	// buttons which save and load each of the quick save slots, so
+	// ButtonSaveState+2 saves to slot 3.
+	ButtonSaveState = 19
+	ButtonLoadState = ButtonSaveState + SlotCount
+
+	// ButtonRewind goes back in time while it is held.
+	ButtonRewind = ButtonLoadState + SlotCount
 )
 
 // IsGameBoyInput checks whether a button value represents a physical button on a gameboy
@@ -91,6 +112,8 @@ func (gb *Gameboy) ProcessInput(buttons ButtonInput) {
 	for _, button := range buttons.Released {
 		if button.IsGameBoyButton() {
 			gb.releaseButton(button)
+		} else if button == ButtonRewind {
+			gb.setRewinding(false)
 		}
 	}
 }
@@ -1,7 +1,6 @@
 package gb
 
 import (
-	"fmt"
 	"gameboy/bits"
 )
 
@@ -13,8 +12,8 @@ func (z *Z80) NOP() {
 
 // 0x01 - LD BC, nn
 func (z *Z80) LD_BC_nn() {
-	lowByte := uint16(z.readMemory(z.PC + 1))
-	highByte := uint16(z.readMemory(z.PC + 2))
+	lowByte := uint16(z.fetch(z.PC + 1))
+	highByte := uint16(z.fetch(z.PC + 2))
 	value := (highByte << 8) | lowByte
 
 	z.BC = value
@@ -29,7 +28,7 @@ func (z *Z80) LD_BC_nn() {
 
 // 0x02 - LD (BC), A
 func (z *Z80) LD_BC_addr_A() {
-	z.Memory.WriteByte(z.BC, z.A)
+	z.Bus.Write(z.BC, z.A)
 	z.PC++
 	z.M = 8
 }
@@ -70,7 +69,7 @@ func (z *Z80) DEC_B() {
 
 // 0x06 - LD B, d8
 func (z *Z80) LD_B_d8() {
-	immediate := z.Memory.ReadByte(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 
 	z.B = immediate
 	z.setBC()
@@ -100,12 +99,12 @@ func (z *Z80) RLCA() {
 
 // 0x08 - LD (a16), SP
 func (z *Z80) LD_a16_SP() {
-	lowByte := uint16(z.readMemory(z.PC + 1))
-	highByte := uint16(z.readMemory(z.PC + 2))
+	lowByte := uint16(z.fetch(z.PC + 1))
+	highByte := uint16(z.fetch(z.PC + 2))
 	address := (highByte << 8) | lowByte
 
-	z.Memory.WriteByte(address, byte(z.SP&0xFF))
-	z.Memory.WriteByte(address+1, byte((z.SP>>8)&0xFF))
+	z.Bus.Write(address, byte(z.SP&0xFF))
+	z.Bus.Write(address+1, byte((z.SP>>8)&0xFF))
 
 	z.PC += 3
 	z.M = 20
@@ -131,7 +130,7 @@ func (z *Z80) ADD_HL_BC() {
 
 // 0x0A - LD A, (BC)
 func (z *Z80) LD_A_BC_addr() {
-	z.A = z.Memory.ReadByte(z.BC)
+	z.A = z.Bus.Read(z.BC)
 	z.setAF()
 
 	z.PC++
@@ -180,7 +179,7 @@ func (z *Z80) DEC_C() {
 // 0x0E - LD C, d8
 func (z *Z80) LD_C_d8() {
 	// Lê o byte imediatamente seguinte ao PC para obter o valor de 8 bits (d8)
-	immediate := z.Memory.ReadByte(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 
 	z.C = immediate
 	z.setBC()
@@ -207,34 +206,19 @@ func (z *Z80) RRCA() {
 
 // 0x10 - STOP
 func (z *Z80) STOP() {
-	z.Memory.gb.halted = true
-
-	if z.Memory.gb.IsCGB() {
-		z.Memory.gb.checkSpeedSwitch()
-	}
+	// The machine switches the speed of a CGB if one was prepared
+	z.Halted = true
+	z.Stopped = true
 
 	z.PC += 2
 	z.M = 4
-
-	// fmt.Println("---------------------------0x10---------------------------")
-	// opcode := z.readMemory(z.PC)
-	// fmt.Println("\n================ Registros ================")
-	// fmt.Printf("Z: %t N: %t HF: %t CF: %t\n", z.Z, z.N, z.HF, z.CF)
-	// fmt.Printf("PC: 0x%X  SP: 0x%X  LY: 0x%X\n", z.PC, z.SP, z.Memory.Hram[0x44])
-	// fmt.Printf("A:  0x%X  F:  0x%X  AF: 0x%X\n", z.A, z.F, z.AF)
-	// fmt.Printf("B:  0x%X  C:  0x%X  BC: 0x%X\n", z.B, z.C, z.BC)
-	// fmt.Printf("D:  0x%X  E:  0x%X  DE: 0x%X\n", z.D, z.E, z.DE)
-	// fmt.Printf("H:  0x%X  L:  0x%X  HL: 0x%X\n", z.H, z.L, z.HL)
-	// fmt.Printf("NEXT OPCODE:  0x%X\n", opcode)
-	// fmt.Println("=============================================")
-	// fmt.Scanln()
 }
 
 // 0x11 - LD DE, nn
 func (z *Z80) LD_DE_nn() {
 	// Lê os bytes imediatos (nn) da memória
-	lowByte := uint16(z.readMemory(z.PC + 1))
-	highByte := uint16(z.readMemory(z.PC + 2))
+	lowByte := uint16(z.fetch(z.PC + 1))
+	highByte := uint16(z.fetch(z.PC + 2))
 
 	value := (highByte << 8) | lowByte
 
@@ -249,7 +233,7 @@ func (z *Z80) LD_DE_nn() {
 
 // 0x12 - LD (DE), A
 func (z *Z80) LD_DE_addr_A() {
-	z.Memory.WriteByte(z.DE, z.A)
+	z.Bus.Write(z.DE, z.A)
 
 	z.PC++
 	z.M = 8
@@ -289,7 +273,7 @@ func (z *Z80) DEC_D() {
 
 // 0x16 - LD D, d8 (Load 8-bit immediate value into D)
 func (z *Z80) LD_D_d8() {
-	immediate := z.Memory.ReadByte(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 	z.D = immediate
 
 	z.setDE()
@@ -317,7 +301,7 @@ func (z *Z80) RLA() {
 
 // 0x18 - JR r8
 func (z *Z80) JR_e() {
-	displacement := int8(z.readMemory(z.PC + 1))
+	displacement := int8(z.fetch(z.PC + 1))
 
 	newAddress := uint16(int(z.PC) + 2 + int(displacement))
 
@@ -345,7 +329,7 @@ func (z *Z80) ADD_HL_DE() {
 
 // 0x1A - LD A, (DE)
 func (z *Z80) LD_A_DE_addr() {
-	z.A = z.Memory.ReadByte(z.DE)
+	z.A = z.Bus.Read(z.DE)
 	z.setAF()
 
 	z.PC++
@@ -385,7 +369,7 @@ func (z *Z80) DEC_E() {
 
 // 0x1E - LD E, d8
 func (z *Z80) LD_E_d8() {
-	immediate := z.Memory.ReadByte(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 
 	z.E = immediate
 	z.setDE()
@@ -417,7 +401,7 @@ func (z *Z80) RRA() {
 // 0x20 - Jump r8 if not zero (!Z)
 func (z *Z80) JR_nz_e() {
 	if !z.Z {
-		displacement := int8(z.readMemory(z.PC + 1))
+		displacement := int8(z.fetch(z.PC + 1))
 
 		newAddress := uint16(int(z.PC) + 2 + int(displacement))
 
@@ -431,8 +415,8 @@ func (z *Z80) JR_nz_e() {
 
 // 0x21 - LD HL, nn
 func (z *Z80) LD_HL_nn() {
-	lowByte := uint16(z.readMemory(z.PC + 1))
-	highByte := uint16(z.readMemory(z.PC + 2))
+	lowByte := uint16(z.fetch(z.PC + 1))
+	highByte := uint16(z.fetch(z.PC + 2))
 	z.HL = (highByte << 8) | lowByte
 
 	z.H = uint8(z.HL >> 8)   // Obtém o byte mais significativo (high byte)
@@ -444,7 +428,7 @@ func (z *Z80) LD_HL_nn() {
 
 // 0x22 - LD (HL+), A
 func (z *Z80) LD_HL_inc_A() {
-	z.Memory.WriteByte(z.HL, z.A)
+	z.Bus.Write(z.HL, z.A)
 
 	z.HL++
 
@@ -491,7 +475,7 @@ func (z *Z80) DEC_H() {
 
 // 0x26 - LD H, d8
 func (z *Z80) LD_H_d8() {
-	immediate := z.Memory.ReadByte(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 	z.H = immediate
 	z.setHL()
 
@@ -537,7 +521,7 @@ func (z *Z80) DAA() {
 
 // 0x28 - jump if zero
 func (z *Z80) JR_Z_e() {
-	displacement := int8(z.readMemory(z.PC + 1))
+	displacement := int8(z.fetch(z.PC + 1))
 
 	if z.Z {
 		newAddress := uint16(int(z.PC) + 2 + int(displacement))
@@ -573,7 +557,7 @@ func (z *Z80) ADD_HL_HL() {
 // 0x2A - LDI A, (HL)
 func (z *Z80) LDI_A_HL() {
 	// Obter o byte da memória no endereço apontado por HL e carregar em A
-	z.A = z.Memory.ReadByte(z.HL)
+	z.A = z.Bus.Read(z.HL)
 	z.setAF()
 
 	z.HL++
@@ -621,7 +605,7 @@ func (z *Z80) DEC_L() {
 
 // 0x2E - LD L, d8
 func (z *Z80) LD_L_d8() {
-	immediate := z.Memory.ReadByte(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 	z.L = immediate
 	z.setHL()
 
@@ -645,7 +629,7 @@ func (z *Z80) CPL() {
 // 0x30 - JR NC, r8 (Jump to relative address r8 if C flag is reset)
 func (z *Z80) JR_NC_r8() {
 	if !z.CF {
-		offset := int8(z.readMemory(z.PC + 1))
+		offset := int8(z.fetch(z.PC + 1))
 		newPC := uint16(int32(z.PC) + int32(offset) + 2)
 
 		z.PC = newPC
@@ -659,8 +643,8 @@ func (z *Z80) JR_NC_r8() {
 
 // 0x31 - LD SP, nn
 func (z *Z80) LD_SP_nn() {
-	lowByte := uint16(z.readMemory(z.PC + 1))
-	highByte := uint16(z.readMemory(z.PC + 2))
+	lowByte := uint16(z.fetch(z.PC + 1))
+	highByte := uint16(z.fetch(z.PC + 2))
 	value := (highByte << 8) | lowByte
 
 	z.SP = value
@@ -670,7 +654,7 @@ func (z *Z80) LD_SP_nn() {
 
 // 0x32 - LD (HL-), A
 func (z *Z80) LD_HL_dec_A() {
-	z.Memory.WriteByte(z.HL, z.A)
+	z.Bus.Write(z.HL, z.A)
 
 	z.HL--
 
@@ -692,9 +676,9 @@ func (z *Z80) INC_SP() {
 
 // 0x34 - INC (HL)
 func (z *Z80) INC_HL_addr() {
-	value := z.Memory.ReadByte(z.HL)
+	value := z.Bus.Read(z.HL)
 	value++
-	z.Memory.WriteByte(z.HL, value)
+	z.Bus.Write(z.HL, value)
 
 	z.updateFlagsInc(value)
 	z.PC++
@@ -703,11 +687,11 @@ func (z *Z80) INC_HL_addr() {
 
 // 0x35 - DEC (HL)
 func (z *Z80) DEC_HL_addr() {
-	value := z.Memory.ReadByte(z.HL)
+	value := z.Bus.Read(z.HL)
 
 	result := value - 1
 
-	z.Memory.WriteByte(z.HL, result)
+	z.Bus.Write(z.HL, result)
 
 	z.Z = result == 0
 	z.N = true
@@ -720,11 +704,11 @@ func (z *Z80) DEC_HL_addr() {
 
 // 0x36 - LD (HL), d8
 func (z *Z80) LD_HL_addr_d8() {
-	immediate := z.readMemory(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 
 	address := z.HL
 
-	z.Memory.WriteByte(address, immediate)
+	z.Bus.Write(address, immediate)
 
 	z.PC += 2
 	//z.M = 4
@@ -745,7 +729,7 @@ func (z *Z80) SCF() {
 
 // 0x38 - jump if carry
 func (z *Z80) JR_C_r8() {
-	displacement := int8(z.readMemory(z.PC + 1))
+	displacement := int8(z.fetch(z.PC + 1))
 
 	if z.CF {
 		newAddress := uint16(int(z.PC) + 2 + int(displacement))
@@ -780,7 +764,7 @@ func (z *Z80) ADD_HL_SP() {
 // 0x3A - LDD A, (HL-)
 func (z *Z80) LDD_A_HL() {
 	// Obter o byte da memória no endereço apontado por HL e carregar em A
-	z.A = z.Memory.ReadByte(z.HL)
+	z.A = z.Bus.Read(z.HL)
 	z.setAF()
 
 	z.HL--
@@ -822,7 +806,7 @@ func (z *Z80) DEC_A() {
 
 // 0x3E -  LD A, d8
 func (z *Z80) LD_A_d8() {
-	immediate := z.readMemory(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 
 	z.A = immediate
 	z.setAF()
@@ -898,7 +882,7 @@ func (z *Z80) LD_B_L() {
 
 // 0x46 - LD B, (HL)
 func (z *Z80) LD_B_HL_addr() {
-	z.B = z.Memory.ReadByte(z.HL)
+	z.B = z.Bus.Read(z.HL)
 	z.setBC()
 
 	z.PC++
@@ -967,7 +951,7 @@ func (z *Z80) LD_C_L() {
 
 // 0x4E - LD C, (HL)
 func (z *Z80) LD_C_HL_addr() {
-	z.C = z.Memory.ReadByte(z.HL)
+	z.C = z.Bus.Read(z.HL)
 	z.setBC()
 
 	z.PC++
@@ -1037,7 +1021,7 @@ func (z *Z80) LD_D_L() {
 
 // 0x56 - LD D, (HL)
 func (z *Z80) LD_D_HL_addr() {
-	z.D = z.Memory.ReadByte(z.HL)
+	z.D = z.Bus.Read(z.HL)
 	z.setDE()
 
 	z.PC++
@@ -1108,7 +1092,7 @@ func (z *Z80) LD_E_L() {
 
 // 0x5E - LD E, (HL)
 func (z *Z80) LD_E_HL_addr() {
-	z.E = z.Memory.ReadByte(z.HL)
+	z.E = z.Bus.Read(z.HL)
 	z.setDE()
 
 	z.PC++
@@ -1178,7 +1162,7 @@ func (z *Z80) LD_H_L() {
 
 // 0x66 - LD H, (HL)
 func (z *Z80) LD_H_HL_addr() {
-	z.H = z.Memory.ReadByte(z.HL)
+	z.H = z.Bus.Read(z.HL)
 	z.setHL()
 
 	z.PC++
@@ -1254,7 +1238,7 @@ func (z *Z80) LD_L_L() {
 
 // 0x6E - LD L, (HL)
 func (z *Z80) LD_L_HL_addr() {
-	z.L = z.Memory.ReadByte(z.HL)
+	z.L = z.Bus.Read(z.HL)
 	z.setHL()
 
 	z.PC++
@@ -1272,7 +1256,7 @@ func (z *Z80) LD_L_A() {
 
 // 0x70 - LD (HL), B
 func (z *Z80) LD_HL_addr_B() {
-	z.Memory.WriteByte(z.HL, z.B)
+	z.Bus.Write(z.HL, z.B)
 
 	z.PC++
 	z.M = 8
@@ -1280,7 +1264,7 @@ func (z *Z80) LD_HL_addr_B() {
 
 // 0x71 - LD (HL), C
 func (z *Z80) LD_HL_addr_C() {
-	z.Memory.WriteByte(z.HL, z.C)
+	z.Bus.Write(z.HL, z.C)
 
 	z.PC++
 	z.M = 8
@@ -1288,7 +1272,7 @@ func (z *Z80) LD_HL_addr_C() {
 
 // 0x72 - LD (HL), D
 func (z *Z80) LD_HL_addr_D() {
-	z.Memory.WriteByte(z.HL, z.D)
+	z.Bus.Write(z.HL, z.D)
 
 	z.PC++
 	z.M = 8
@@ -1296,28 +1280,28 @@ func (z *Z80) LD_HL_addr_D() {
 
 // 0x73 - LD (HL), E
 func (z *Z80) LD_HL_addr_E() {
-	z.Memory.WriteByte(z.HL, z.E)
+	z.Bus.Write(z.HL, z.E)
 	z.PC++
 	z.M = 8
 }
 
 // 0x74 - LD (HL), H
 func (z *Z80) LD_HL_addr_H() {
-	z.Memory.WriteByte(z.HL, z.H)
+	z.Bus.Write(z.HL, z.H)
 	z.PC++
 	z.M = 8
 }
 
 // 0x75 - LD (HL), L
 func (z *Z80) LD_HL_addr_L() {
-	z.Memory.WriteByte(z.HL, z.L)
+	z.Bus.Write(z.HL, z.L)
 	z.PC++
 	z.M = 8
 }
 
 // 0x76 - HALT
 func (z *Z80) HALT() {
-	z.Memory.gb.halted = true
+	z.Halted = true
 
 	z.PC++
 	z.M = 4
@@ -1325,7 +1309,7 @@ func (z *Z80) HALT() {
 
 // 0x77 - LD (HL), A
 func (z *Z80) LD_HL_addr_A() {
-	z.Memory.WriteByte(z.HL, z.A)
+	z.Bus.Write(z.HL, z.A)
 
 	z.PC++
 	z.M = 8
@@ -1387,7 +1371,7 @@ func (z *Z80) LD_A_L() {
 
 // 0x7E - LD A, (HL)
 func (z *Z80) LD_A_HL_addr() {
-	z.A = z.Memory.ReadByte(z.HL)
+	z.A = z.Bus.Read(z.HL)
 	z.setAF()
 
 	z.PC++
@@ -1834,7 +1818,7 @@ func (z *Z80) OR_L() {
 
 // 0xB6 - OR (HL)
 func (z *Z80) OR_HL_addr() {
-	value := z.Memory.ReadByte(z.HL)
+	value := z.Bus.Read(z.HL)
 	z.updateFlagsOr(value)
 
 	z.PC++
@@ -1918,11 +1902,10 @@ func (z *Z80) CP_A() {
 // 0xC0 - RET NZ (Return if Not Zero)
 func (z *Z80) RET_NZ() {
 	if !z.Z {
-		lowByte := z.Memory.ReadWord(z.SP)
-		highByte := z.Memory.ReadWord(z.SP + 1)
+		returnAddress := z.readWord(z.SP)
 		z.SP += 2
 
-		z.PC = (highByte << 8) | lowByte
+		z.PC = returnAddress
 		z.M = 20
 	} else {
 		z.PC++
@@ -1947,8 +1930,8 @@ func (z *Z80) POP_BC() {
 // 0xC2 - JP NZ, nn (Jump to address nn if not zero !Z)
 func (z *Z80) JP_NZ_nn() {
 	// Lê os bytes imediatos (nn) da memória
-	lowByte := uint16(z.readMemory(z.PC + 1))
-	highByte := uint16(z.readMemory(z.PC + 2))
+	lowByte := uint16(z.fetch(z.PC + 1))
+	highByte := uint16(z.fetch(z.PC + 2))
 	address := (highByte << 8) | lowByte
 
 	if !z.Z {
@@ -1962,8 +1945,8 @@ func (z *Z80) JP_NZ_nn() {
 
 // 0xC3 - JP nn
 func (z *Z80) JP_nn() {
-	lowByte := uint16(z.readMemory(z.PC + 1))
-	highByte := uint16(z.readMemory(z.PC + 2))
+	lowByte := uint16(z.fetch(z.PC + 1))
+	highByte := uint16(z.fetch(z.PC + 2))
 	targetAddress := (highByte << 8) | lowByte
 
 	z.PC = targetAddress
@@ -1973,14 +1956,14 @@ func (z *Z80) JP_nn() {
 // 0xC4 - CALL NZ nn
 func (z *Z80) CALL_NZ_nn() {
 	if !z.Z {
-		lowByte := uint16(z.readMemory(z.PC + 1))
-		highByte := uint16(z.readMemory(z.PC + 2))
+		lowByte := uint16(z.fetch(z.PC + 1))
+		highByte := uint16(z.fetch(z.PC + 2))
 		address := (highByte << 8) | lowByte
 
 		returnAddress := z.PC + 3
 
 		z.SP -= 2
-		z.Memory.WriteWord(z.SP, returnAddress)
+		z.writeWord(z.SP, returnAddress)
 
 		z.PC = address
 		z.M = 24
@@ -1993,8 +1976,8 @@ func (z *Z80) CALL_NZ_nn() {
 
 // 0xC5 - PUSH BC
 func (z *Z80) PUSH_BC() {
-	z.Memory.WriteByte(z.SP-1, byte(z.B))
-	z.Memory.WriteByte(z.SP-2, byte(z.C))
+	z.Bus.Write(z.SP-1, byte(z.B))
+	z.Bus.Write(z.SP-2, byte(z.C))
 
 	z.SP -= 2
 
@@ -2004,7 +1987,7 @@ func (z *Z80) PUSH_BC() {
 
 // 0xC6 - ADD A, d8
 func (z *Z80) ADD_A_d8() {
-	immediate := z.readMemory(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 	z.updateFlagsAdd(z.A, immediate)
 
 	z.PC += 2
@@ -2015,7 +1998,7 @@ func (z *Z80) ADD_A_d8() {
 // 0xC7 - RST 00H
 func (z *Z80) RST_00H() {
 	z.SP -= 2
-	z.Memory.WriteWord(z.SP, z.PC+1)
+	z.writeWord(z.SP, z.PC+1)
 
 	// Salto para o endereço 0x0000
 	z.PC = 0x0000
@@ -2025,7 +2008,7 @@ func (z *Z80) RST_00H() {
 // 0xC8 - RET Z (Return if Zero)
 func (z *Z80) RET_Z() {
 	if z.Z {
-		returnAddress := z.Memory.ReadWord(z.SP)
+		returnAddress := z.readWord(z.SP)
 		z.SP += 2
 
 		z.PC = returnAddress
@@ -2038,7 +2021,7 @@ func (z *Z80) RET_Z() {
 
 // 0xC9 - RET
 func (z *Z80) RET() {
-	returnAddress := z.Memory.ReadWord(z.SP)
+	returnAddress := z.readWord(z.SP)
 	z.SP += 2
 
 	z.PC = returnAddress
@@ -2047,8 +2030,8 @@ func (z *Z80) RET() {
 
 // 0xCA - JP Z, nn
 func (z *Z80) JP_Z_nn() {
-	lowByte := uint16(z.readMemory(z.PC + 1))
-	highByte := uint16(z.readMemory(z.PC + 2))
+	lowByte := uint16(z.fetch(z.PC + 1))
+	highByte := uint16(z.fetch(z.PC + 2))
 	address := (highByte << 8) | lowByte
 
 	if z.Z {
@@ -2064,14 +2047,14 @@ func (z *Z80) JP_Z_nn() {
 // 0xCC - CALL Z nn
 func (z *Z80) CALL_Z_nn() {
 	if z.Z {
-		lowByte := uint16(z.readMemory(z.PC + 1))
-		highByte := uint16(z.readMemory(z.PC + 2))
+		lowByte := uint16(z.fetch(z.PC + 1))
+		highByte := uint16(z.fetch(z.PC + 2))
 		address := (highByte << 8) | lowByte
 
 		returnAddress := z.PC + 3
 
 		z.SP -= 2
-		z.Memory.WriteWord(z.SP, returnAddress)
+		z.writeWord(z.SP, returnAddress)
 
 		z.PC = address
 		z.M = 24
@@ -2084,14 +2067,14 @@ func (z *Z80) CALL_Z_nn() {
 
 // 0xCD - CALL nn
 func (z *Z80) CALL_nn() {
-	lowByte := uint16(z.readMemory(z.PC + 1))
-	highByte := uint16(z.readMemory(z.PC + 2))
+	lowByte := uint16(z.fetch(z.PC + 1))
+	highByte := uint16(z.fetch(z.PC + 2))
 	address := (highByte << 8) | lowByte
 
 	returnAddress := z.PC + 3
 
 	z.SP -= 2
-	z.Memory.WriteWord(z.SP, returnAddress)
+	z.writeWord(z.SP, returnAddress)
 
 	z.PC = address
 	z.M = 24
@@ -2099,7 +2082,7 @@ func (z *Z80) CALL_nn() {
 
 // 0xCE - ADC A, d8 (Add with Carry immediate 8-bit to A)
 func (z *Z80) ADC_A_d8() {
-	immediate := z.readMemory(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 	z.updateFlagsAdc(z.A, immediate)
 
 	z.PC += 2
@@ -2109,7 +2092,7 @@ func (z *Z80) ADC_A_d8() {
 // 0xCF - RST 08H
 func (z *Z80) RST_08H() {
 	z.SP -= 2
-	z.Memory.WriteWord(z.SP, z.PC+1)
+	z.writeWord(z.SP, z.PC+1)
 
 	// Salto para o endereço 0x0008
 	z.PC = 0x0008
@@ -2119,8 +2102,8 @@ func (z *Z80) RST_08H() {
 // 0xD0 - RET NC (Return if Not Carry)
 func (z *Z80) RET_NC() {
 	if !z.CF {
-		lowByte := uint16(z.Memory.ReadByte(z.SP))
-		highByte := uint16(z.Memory.ReadByte(z.SP+1)) << 8
+		lowByte := uint16(z.Bus.Read(z.SP))
+		highByte := uint16(z.Bus.Read(z.SP+1)) << 8
 
 		z.SP += 2
 
@@ -2150,8 +2133,8 @@ func (z *Z80) POP_DE() {
 // 0xD2 - JP NC, nn (Jump to address nn if not carry !CF)
 func (z *Z80) JP_NC_nn() {
 	// Lê os bytes imediatos (nn) da memória
-	lowByte := uint16(z.readMemory(z.PC + 1))
-	highByte := uint16(z.readMemory(z.PC + 2))
+	lowByte := uint16(z.fetch(z.PC + 1))
+	highByte := uint16(z.fetch(z.PC + 2))
 	address := (highByte << 8) | lowByte
 
 	if !z.CF {
@@ -2166,14 +2149,14 @@ func (z *Z80) JP_NC_nn() {
 // 0xD4 - CALL NC nn
 func (z *Z80) CALL_NC_nn() {
 	if !z.CF {
-		lowByte := uint16(z.readMemory(z.PC + 1))
-		highByte := uint16(z.readMemory(z.PC + 2))
+		lowByte := uint16(z.fetch(z.PC + 1))
+		highByte := uint16(z.fetch(z.PC + 2))
 		address := (highByte << 8) | lowByte
 
 		returnAddress := z.PC + 3
 
 		z.SP -= 2
-		z.Memory.WriteWord(z.SP, returnAddress)
+		z.writeWord(z.SP, returnAddress)
 
 		z.PC = address
 		z.M = 24
@@ -2186,8 +2169,8 @@ func (z *Z80) CALL_NC_nn() {
 
 // 0xD5 - PUSH DE
 func (z *Z80) PUSH_DE() {
-	z.Memory.WriteByte(z.SP-1, byte(z.D))
-	z.Memory.WriteByte(z.SP-2, byte(z.E))
+	z.Bus.Write(z.SP-1, byte(z.D))
+	z.Bus.Write(z.SP-2, byte(z.E))
 	z.SP -= 2
 
 	z.PC++
@@ -2196,7 +2179,7 @@ func (z *Z80) PUSH_DE() {
 
 // 0xD6 - SUB A, d8
 func (z *Z80) SUB_A_d8() {
-	immediate := z.readMemory(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 	z.updateFlagsSub(z.A, immediate)
 
 	z.PC += 2
@@ -2207,7 +2190,7 @@ func (z *Z80) SUB_A_d8() {
 // 0xD7 - RST 10H
 func (z *Z80) RST_10H() {
 	z.SP -= 2
-	z.Memory.WriteWord(z.SP, z.PC+1)
+	z.writeWord(z.SP, z.PC+1)
 
 	// Salto para o endereço 0x0010
 	z.PC = 0x0010
@@ -2217,7 +2200,7 @@ func (z *Z80) RST_10H() {
 // 0xD8 - RET C (Return if Carry)
 func (z *Z80) RET_C() {
 	if z.CF {
-		returnAddress := z.Memory.ReadWord(z.SP)
+		returnAddress := z.readWord(z.SP)
 		z.SP += 2
 
 		z.PC = returnAddress
@@ -2246,8 +2229,8 @@ func (z *Z80) RETI() {
 
 // 0xDA - JP C, nn
 func (z *Z80) JP_C_nn() {
-	lowByte := uint16(z.readMemory(z.PC + 1))
-	highByte := uint16(z.readMemory(z.PC + 2))
+	lowByte := uint16(z.fetch(z.PC + 1))
+	highByte := uint16(z.fetch(z.PC + 2))
 	address := (highByte << 8) | lowByte
 
 	if z.CF {
@@ -2263,14 +2246,14 @@ func (z *Z80) JP_C_nn() {
 // 0xDC - CALL C nn
 func (z *Z80) CALL_C_nn() {
 	if z.CF {
-		lowByte := uint16(z.readMemory(z.PC + 1))
-		highByte := uint16(z.readMemory(z.PC + 2))
+		lowByte := uint16(z.fetch(z.PC + 1))
+		highByte := uint16(z.fetch(z.PC + 2))
 		address := (highByte << 8) | lowByte
 
 		returnAddress := z.PC + 3
 
 		z.SP -= 2
-		z.Memory.WriteWord(z.SP, returnAddress)
+		z.writeWord(z.SP, returnAddress)
 
 		z.PC = address
 		z.M = 24
@@ -2283,7 +2266,7 @@ func (z *Z80) CALL_C_nn() {
 
 // 0xDE - SBC A, d8 (Subtract with Carry)
 func (z *Z80) SBC_A_d8() {
-	immediate := z.readMemory(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 
 	carry := uint8(0)
 	if z.CF {
@@ -2307,7 +2290,7 @@ func (z *Z80) SBC_A_d8() {
 // 0xDF - RST 18H
 func (z *Z80) RST_18H() {
 	z.SP -= 2
-	z.Memory.WriteWord(z.SP, z.PC+1)
+	z.writeWord(z.SP, z.PC+1)
 
 	// Salto para o endereço 0x0018
 	z.PC = 0x0018
@@ -2316,11 +2299,11 @@ func (z *Z80) RST_18H() {
 
 // 0xE0 - LD address a8, A
 func (z *Z80) LDH_a8_A() {
-	immediate := z.readMemory(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 
 	address := uint16(0xFF00) + uint16(immediate)
 
-	z.Memory.WriteByte(address, z.A)
+	z.Bus.Write(address, z.A)
 
 	z.PC += 2
 	//z.M = 12
@@ -2347,18 +2330,17 @@ func (z *Z80) POP_HL() {
 func (z *Z80) LD_C_addr_A() {
 	address := uint16(0xFF00) + uint16(z.C) // Calcular o endereço baseado em 0xFF00 + valor do registrador C
 
-	z.Memory.WriteByte(address, z.A) // Armazenar o valor do registrador A no endereço calculado
+	z.Bus.Write(address, z.A) // Armazenar o valor do registrador A no endereço calculado
 
 	z.PC++
 	//z.PC += 2
 	z.M = 8
-	fmt.Printf("0xE2  Address: 0x%X  Value: 0x%X\n", address, z.A)
 }
 
 // 0xE5 - PUSH HL
 func (z *Z80) PUSH_HL() {
-	z.Memory.WriteByte(z.SP-1, byte(z.H))
-	z.Memory.WriteByte(z.SP-2, byte(z.L))
+	z.Bus.Write(z.SP-1, byte(z.H))
+	z.Bus.Write(z.SP-2, byte(z.L))
 	z.SP -= 2
 
 	z.PC++
@@ -2367,7 +2349,7 @@ func (z *Z80) PUSH_HL() {
 
 // 0xE6 - AND n
 func (z *Z80) AND_n() {
-	immediate := z.readMemory(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 	z.updateFlagsAnd(immediate)
 
 	z.PC += 2
@@ -2377,7 +2359,7 @@ func (z *Z80) AND_n() {
 // 0xE7 - RST 20H
 func (z *Z80) RST_20H() {
 	z.SP -= 2
-	z.Memory.WriteWord(z.SP, z.PC+1)
+	z.writeWord(z.SP, z.PC+1)
 
 	// Salto para o endereço 0x0018
 	z.PC = 0x0020
@@ -2386,7 +2368,7 @@ func (z *Z80) RST_20H() {
 
 // 0xE8 - ADD SP, r8
 func (z *Z80) ADD_SP_r8() {
-	immediate := int8((z.readMemory(z.PC + 1)))
+	immediate := int8((z.fetch(z.PC + 1)))
 	total := uint16(int32(z.SP) + int32(immediate))
 	tmpVal := z.SP ^ uint16(immediate) ^ total
 
@@ -2412,9 +2394,9 @@ func (z *Z80) JP_HL_addr() {
 
 // 0xEA - LD nn, A
 func (z *Z80) LD_nn_A() {
-	address := uint16(z.readMemory(z.PC+1)) | (uint16(z.readMemory(z.PC+2)) << 8)
+	address := uint16(z.fetch(z.PC+1)) | (uint16(z.fetch(z.PC+2)) << 8)
 
-	z.Memory.WriteByte(address, z.A)
+	z.Bus.Write(address, z.A)
 
 	z.PC += 3
 	//z.M = 16
@@ -2423,7 +2405,7 @@ func (z *Z80) LD_nn_A() {
 
 // 0xEE - XOR d8 (Exclusive OR immediate 8-bit with A)
 func (z *Z80) XOR_d8() {
-	immediate := z.readMemory(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 	z.updateFlagsXor(immediate)
 
 	z.PC += 2
@@ -2433,7 +2415,7 @@ func (z *Z80) XOR_d8() {
 // 0xEF - RST 28H
 func (z *Z80) RST_28H() {
 	z.SP -= 2
-	z.Memory.WriteWord(z.SP, z.PC+1)
+	z.writeWord(z.SP, z.PC+1)
 
 	// Salta para o endereço 0x0028
 	z.PC = 0x0028
@@ -2442,7 +2424,7 @@ func (z *Z80) RST_28H() {
 
 // 0xF0 - LDH A a8
 func (z *Z80) LDH_A_a8() {
-	immediate := z.readMemory(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 
 	// Calcula o endereço completo: 0xFF00 + a8
 	address := uint16(0xFF00) + uint16(immediate)
@@ -2479,7 +2461,7 @@ func (z *Z80) POP_AF() {
 // 0xF2 - LD A, (C)
 func (z *Z80) LD_A_C_addr() {
 	address := uint16(0xFF00) + uint16(z.C)
-	z.A = z.Memory.ReadByte(address)
+	z.A = z.Bus.Read(address)
 	z.setAF()
 
 	z.PC++
@@ -2496,8 +2478,8 @@ func (z *Z80) DI() {
 
 // 0xF5 - PUSH AF
 func (z *Z80) PUSH_AF() {
-	z.Memory.WriteByte(z.SP-1, byte(z.A))
-	z.Memory.WriteByte(z.SP-2, byte(z.F))
+	z.Bus.Write(z.SP-1, byte(z.A))
+	z.Bus.Write(z.SP-2, byte(z.F))
 	z.SP -= 2
 
 	z.PC++
@@ -2507,7 +2489,7 @@ func (z *Z80) PUSH_AF() {
 
 // 0xF6 - OR d8 (Logical OR immediate with A)
 func (z *Z80) OR_d8() {
-	immediate := z.readMemory(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 	z.updateFlagsOr(immediate)
 
 	z.PC += 2
@@ -2517,7 +2499,7 @@ func (z *Z80) OR_d8() {
 // 0xF7 - RST 30H
 func (z *Z80) RST_30H() {
 	z.SP -= 2
-	z.Memory.WriteWord(z.SP, z.PC+1)
+	z.writeWord(z.SP, z.PC+1)
 
 	// Salta para o endereço 0x0030
 	z.PC = 0x0030
@@ -2526,7 +2508,7 @@ func (z *Z80) RST_30H() {
 
 // 0xF8 - LD HL, SP+r8 (Load HL with SP plus signed 8-bit offset)
 func (z *Z80) LD_HL_SP_r8() {
-	displacement := int8(z.readMemory(z.PC + 1))
+	displacement := int8(z.fetch(z.PC + 1))
 
 	total := uint16(int32(z.SP) + int32(displacement))
 
@@ -2561,8 +2543,8 @@ func (z *Z80) LD_SP_HL() {
 
 // 0xFA - LD A, nn
 func (z *Z80) LD_A_nn() {
-	lowByte := uint16(z.readMemory(z.PC + 1))
-	highByte := uint16(z.readMemory(z.PC + 2))
+	lowByte := uint16(z.fetch(z.PC + 1))
+	highByte := uint16(z.fetch(z.PC + 2))
 	address := (highByte << 8) | lowByte
 
 	z.A = z.readMemory(address)
@@ -2582,7 +2564,7 @@ func (z *Z80) EI() {
 
 // 0xFE - CP n
 func (z *Z80) CP_n() {
-	immediate := z.readMemory(z.PC + 1)
+	immediate := z.fetch(z.PC + 1)
 
 	result := z.A - immediate
 
@@ -2600,7 +2582,7 @@ func (z *Z80) CP_n() {
 // 0xFF - RST 38H
 func (z *Z80) RST_38H() {
 	z.SP -= 2
-	z.Memory.WriteWord(z.SP, z.PC+1)
+	z.writeWord(z.SP, z.PC+1)
 
 	// Salto para o endereço 0x0038
 	z.PC = 0x0038
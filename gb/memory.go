@@ -1,10 +1,10 @@
 package gb
 
 import (
-	"fmt"
 	"gameboy/bits"
 	"gameboy/cart"
 	"log"
+	"time"
 )
 
 type Memory struct {
@@ -24,9 +24,19 @@ type Memory struct {
 
 	hdmaLength byte
 	hdmaActive bool
+
+	// If the reads and writes are made by the CPU and are passed on to
+	// the debugger.
+	watching bool
 }
 
 const (
+	// SB is the serial transfer data register, which holds the byte to send
+	// over the link cable and then the byte received.
+	SB = 0xFF01
+	// SC is the serial transfer control register, which starts a transfer
+	// and selects the clock.
+	SC = 0xFF02
 	// DIV is the divider register which is incremented periodically by
 	// the Gameboy.
 	DIV = 0xFF04
@@ -51,24 +61,6 @@ func (m *Memory) Init(gameboy *Gameboy) {
 	m.Hram[0x06] = 0x00
 	m.Hram[0x07] = 0xF8
 	m.Hram[0x0F] = 0xE1
-	m.Hram[0x10] = 0x80
-	m.Hram[0x11] = 0xBF
-	m.Hram[0x12] = 0xF3
-	m.Hram[0x14] = 0xBF
-	m.Hram[0x16] = 0x3F
-	m.Hram[0x17] = 0x00
-	m.Hram[0x19] = 0xBF
-	m.Hram[0x1A] = 0x7F
-	m.Hram[0x1B] = 0xFF
-	m.Hram[0x1C] = 0x9F
-	m.Hram[0x1E] = 0xBF
-	m.Hram[0x20] = 0xFF
-	m.Hram[0x21] = 0x00
-	m.Hram[0x22] = 0x00
-	m.Hram[0x23] = 0xBF
-	m.Hram[0x24] = 0x77
-	m.Hram[0x25] = 0xF3
-	m.Hram[0x26] = 0xF1
 	m.Hram[0x40] = 0x91
 	m.Hram[0x41] = 0x85
 	m.Hram[0x42] = 0x00
@@ -84,9 +76,15 @@ func (m *Memory) Init(gameboy *Gameboy) {
 	m.WramBank = 1
 }
 
-func (m *Memory) LoadCart(rom string) (bool, error) {
+// LoadCart loads the cart and returns if it supports CGB mode. If rtcEpoch
+// is not nil the cart's RTC uses a virtual clock starting from it.
+func (m *Memory) LoadCart(rom []byte, filename string, rtcEpoch *time.Time) (bool, error) {
 	var err error
-	m.Cart, err = cart.NewCartFromFile(rom)
+	if rtcEpoch != nil {
+		m.Cart, err = cart.NewVirtualClockCart(rom, filename, *rtcEpoch)
+	} else {
+		m.Cart, err = cart.NewCart(rom, filename)
+	}
 	if err != nil {
 		return false, err
 	}
@@ -94,6 +92,14 @@ func (m *Memory) LoadCart(rom string) (bool, error) {
 }
 
 func (m *Memory) ReadByte(addr uint16) byte {
+	value := m.readByte(addr)
+	if m.watching {
+		m.gb.debugger.access(addr, value, WatchRead)
+	}
+	return value
+}
+
+func (m *Memory) readByte(addr uint16) byte {
 	switch {
 	case addr < 0x8000: // ROM
 		return m.Cart.Read(addr)
@@ -125,6 +131,9 @@ func (m *Memory) ReadByte(addr uint16) byte {
 		// Unusable memory
 		return 0xFF
 
+	case addr == 0xFF44 && m.gb.trace != nil && m.gb.trace.started && m.gb.trace.opts.DoctorLY:
+		return 0x90
+
 	default:
 		return m.ReadHighRam(addr)
 	}
@@ -137,14 +146,12 @@ func (m *Memory) ReadHighRam(addr uint16) byte {
 	case addr == 0xFF00:
 		return m.gb.joypadValue(m.Hram[0x00])
 
-	case addr >= 0xFF10 && addr <= 0xFF26:
-		return 0xFF
-	// 	return mem.gb.Sound.Read(addr)
+	case addr >= 0xFF10 && addr <= 0xFF2F:
+		return m.gb.Sound.Read(addr)
 
 	case addr >= 0xFF30 && addr <= 0xFF3F:
-		return 0xFF
-	// 	// Writing to channel 3 waveform RAM.
-	// 	return mem.gb.Sound.Read(addr)
+		// Reading from channel 3 waveform RAM.
+		return m.gb.Sound.ReadWaveform(addr)
 
 	case addr == 0xFF0F:
 		return m.Hram[0x0F] | 0xE0
@@ -204,6 +211,9 @@ func (m *Memory) ReadHighRam(addr uint16) byte {
 }
 
 func (m *Memory) WriteByte(addr uint16, value byte) {
+	if m.watching {
+		m.gb.debugger.access(addr, value, WatchWrite)
+	}
 
 	switch {
 	case addr < 0x8000:
@@ -228,8 +238,7 @@ func (m *Memory) WriteByte(addr uint16, value byte) {
 		m.Wram[(addr-0xC000)+(uint16(m.WramBank)*0x1000)] = value
 
 	case addr < 0xFE00:
-		fmt.Println("ECHO")
-		fmt.Scanln()
+		// Echo RAM, which reads back as 0xFF, so writes are ignored
 
 	case addr < 0xFEA0:
 		m.Oam[addr-0xFE00] = value
@@ -253,35 +262,16 @@ func (m *Memory) WriteHighRam(addr uint16, value byte) {
 		// Restricted RAM
 		return
 
-	case addr >= 0xFF10 && addr <= 0xFF26:
-		break
-		// m.gb.Sound.Write(address, value)
+	case addr >= 0xFF10 && addr <= 0xFF2F:
+		m.gb.Sound.Write(addr, value)
 
 	case addr >= 0xFF30 && addr <= 0xFF3F:
-		break
 		// Writing to channel 3 waveform RAM.
-		// m.gb.Sound.WriteWaveform(addr, value)
+		m.gb.Sound.WriteWaveform(addr, value)
 
-	case addr == 0xFF02:
-		break
-		//Serial transfer control
-		// if value == 0x81{
-		// 	fmt.Println("Transfer")
-		// 	fmt.Println(m.ReadHighRam(0xFF01))
-
-		// 	fmt.Scanln()
-		// }else{
-		// 	fmt.Printf("Transfer Value: 0x%X\n", value)
-		// 	fmt.Println(m.ReadHighRam(0xFF01))
-		// 	fmt.Scanln()
-		// }
-
-		// if value == 0x81 {
-		// 	f := m.gb.options.transferFunction
-		// 	if f != nil {
-		// 		f(m.ReadHighRam(0xFF01))
-		// 	}
-		// }
+	case addr == SC:
+		// Serial transfer control
+		m.gb.writeSerialControl(value)
 
 	case addr == DIV:
 		// Trap divider register
@@ -0,0 +1,265 @@
+package gb
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var (
+	mooneyeDir    = flag.String("mooneye.dir", "../mooneye-test-suite", "directory of the built mooneye-test-suite roms")
+	mooneyeUpdate = flag.Bool("mooneye.update", false, "rewrite the mooneye manifest with the results of the run")
+)
+
+// mooneyeManifest has the expected result of each mooneye ROM.
+const mooneyeManifest = "testdata/mooneye.txt"
+
+// mooneyeTimeout is the number of emulated seconds a ROM has to reach its
+// software breakpoint.
+const mooneyeTimeout = 20
+
+// mooneyeExpectation is a line of the manifest.
+type mooneyeExpectation struct {
+	rom  string
+	pass bool
+	cgb  bool
+}
+
+func TestMooneye(t *testing.T) {
+	if _, err := os.Stat(*mooneyeDir); err != nil {
+		t.Skipf("no mooneye roms: %v", err)
+	}
+	manifest, err := readMooneyeManifest(mooneyeManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roms, err := findMooneyeROMs(*mooneyeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var results []mooneyeExpectation
+	t.Run("roms", func(t *testing.T) {
+		for _, rom := range roms {
+			rom := rom
+			want, listed := manifest[rom]
+			if !listed {
+				want = mooneyeExpectation{rom: rom, cgb: mooneyeIsCGB(rom)}
+			}
+			t.Run(rom, func(t *testing.T) {
+				t.Parallel()
+				passed, err := runMooneye(filepath.Join(*mooneyeDir, rom), want.cgb)
+				if err != nil {
+					t.Log(err)
+				}
+				mu.Lock()
+				results = append(results, mooneyeExpectation{rom: rom, pass: passed, cgb: want.cgb})
+				mu.Unlock()
+
+				switch {
+				case *mooneyeUpdate:
+				case !listed:
+					t.Errorf("not in %s (passed: %v), update it with -mooneye.update", mooneyeManifest, passed)
+				case passed && !want.pass:
+					t.Errorf("passed but is expected to fail, update %s", mooneyeManifest)
+				case !passed && want.pass:
+					t.Error("failed")
+				}
+			})
+		}
+	})
+
+	if *mooneyeUpdate {
+		if err := writeMooneyeManifest(mooneyeManifest, results); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMooneyeBreakpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		pass    bool
+	}{
+		{
+			name: "pass",
+			program: []byte{
+				0x06, 3, 0x0E, 5, 0x16, 8, 0x1E, 13, 0x26, 21, 0x2E, 34, // ld b, 3 ... ld l, 34
+				0x40,       // ld b, b
+				0x18, 0xFE, // jr @
+			},
+			pass: true,
+		},
+		{
+			name: "fail",
+			program: []byte{
+				0x3E, 0x42, 0x47, 0x4F, 0x57, 0x5F, 0x67, 0x6F, // ld a, $42; ld b, a ... ld l, a
+				0x40,       // ld b, b
+				0x18, 0xFE, // jr @
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rom := make([]byte, 0x8000)
+			copy(rom[0x100:], test.program)
+			gameboy, err := New(Options{ROM: rom})
+			if err != nil {
+				t.Fatal(err)
+			}
+			passed, err := runMooneyeGameboy(gameboy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if passed != test.pass {
+				t.Errorf("got passed %v, want %v", passed, test.pass)
+			}
+		})
+	}
+}
+
+// runMooneye runs a mooneye ROM until it reaches its software breakpoint and
+// returns if it passed.
+func runMooneye(rom string, cgb bool) (bool, error) {
+	data, err := os.ReadFile(rom)
+	if err != nil {
+		return false, err
+	}
+	gameboy, err := New(Options{ROM: data, CGB: cgb})
+	if err != nil {
+		return false, err
+	}
+	return runMooneyeGameboy(gameboy)
+}
+
+// runMooneyeGameboy runs until the LD B,B software breakpoint. The test passed
+// if the registers then hold the start of the Fibonacci sequence, and failed
+// if they hold 0x42 or anything else.
+func runMooneyeGameboy(gameboy *Gameboy) (bool, error) {
+	if err := runToBreakpoint(gameboy, mooneyeTimeout); err != nil {
+		return false, err
+	}
+	cpu := gameboy.CPU
+	return cpu.B == 3 && cpu.C == 5 && cpu.D == 8 && cpu.E == 13 && cpu.H == 21 && cpu.L == 34, nil
+}
+
+// runToBreakpoint runs until the LD B,B software breakpoint, or fails after
+// timeout emulated seconds.
+func runToBreakpoint(gameboy *Gameboy, timeout int) error {
+	for cycles := 0; !gameboy.CPU.Breakpoint; {
+		if cycles > timeout*ClockSpeed {
+			return fmt.Errorf("timed out after %d seconds", timeout)
+		}
+		cycles += gameboy.step()
+	}
+	return nil
+}
+
+// mooneyeSkipDirs are the directories of ROMs which do not report a result:
+// tools for dumping the boot ROM and such, and tests which need checking by
+// hand.
+var mooneyeSkipDirs = map[string]bool{
+	"utils":       true,
+	"manual-only": true,
+}
+
+// findMooneyeROMs returns the paths of the ROMs in a directory and its
+// subdirectories, relative to it with forward slashes. The directories in
+// mooneyeSkipDirs are left out.
+func findMooneyeROMs(dir string) ([]string, error) {
+	var roms []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if mooneyeSkipDirs[d.Name()] {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".gb" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		roms = append(roms, filepath.ToSlash(rel))
+		return err
+	})
+	return roms, err
+}
+
+// mooneyeIsCGB returns if a ROM which is not in the manifest should be run in
+// colour mode, from the models in its name such as "-cgb" or "-C".
+func mooneyeIsCGB(rom string) bool {
+	name := strings.TrimSuffix(filepath.Base(rom), ".gb")
+	return strings.Contains(name, "-cgb") || strings.HasSuffix(name, "-C")
+}
+
+// readMooneyeManifest reads the expected results, where each line is "pass"
+// or "fail" followed by the ROM and optionally "cgb".
+func readMooneyeManifest(filename string) (map[string]mooneyeExpectation, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	manifest := make(map[string]mooneyeExpectation)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 || (fields[0] != "pass" && fields[0] != "fail") ||
+			(len(fields) == 3 && fields[2] != "cgb") {
+			return nil, fmt.Errorf("%s:%d: expected pass|fail rom [cgb]", filename, line)
+		}
+		manifest[fields[1]] = mooneyeExpectation{
+			rom:  fields[1],
+			pass: fields[0] == "pass",
+			cgb:  len(fields) == 3,
+		}
+	}
+	return manifest, scanner.Err()
+}
+
+// writeMooneyeManifest replaces the expected results, keeping the comments at
+// the start of the file.
+func writeMooneyeManifest(filename string, results []mooneyeExpectation) error {
+	data, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		b.WriteString(line)
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].rom < results[j].rom })
+	for _, r := range results {
+		result := "fail"
+		if r.pass {
+			result = "pass"
+		}
+		fmt.Fprintf(&b, "%s %s", result, r.rom)
+		if r.cgb {
+			b.WriteString(" cgb")
+		}
+		b.WriteString("\n")
+	}
+	return os.WriteFile(filename, []byte(b.String()), 0644)
+}
@@ -0,0 +1,194 @@
+package gb
+
+import (
+	"bytes"
+	"compress/flate"
+	"gameboy/savestate"
+	"io"
+)
+
+// Default settings for rewinding used by the frontend.
+const (
+	// DefaultRewindBudget is the number of bytes of memory the rewind
+	// snapshots can use.
+	DefaultRewindBudget = 64 << 20
+	// DefaultRewindInterval is the number of frames between snapshots.
+	DefaultRewindInterval = 2
+)
+
+// rewindBuffer keeps snapshots of the machine to rewind to. The newest
+// snapshot is kept whole, and each older one as the compressed difference
+// from the one after it, in a ring which drops the oldest snapshots once
+// they use more than the memory budget.
+type rewindBuffer struct {
+	budget   int
+	interval int
+
+	// The newest snapshot and the number of frames run since it was taken.
+	latest        []byte
+	sinceSnapshot int
+
+	// Ring of compressed deltas, oldest first, and their total size.
+	deltas [][]byte
+	start  int
+	count  int
+	size   int
+
+	// Buffers reused for taking snapshots and working out deltas.
+	snapshot bytes.Buffer
+	scratch  []byte
+}
+
+func newRewindBuffer(budget, interval int) *rewindBuffer {
+	if interval < 1 {
+		interval = 1
+	}
+	return &rewindBuffer{
+		budget:   budget,
+		interval: interval,
+		deltas:   make([][]byte, 64),
+	}
+}
+
+// push adds a snapshot as the newest one.
+func (r *rewindBuffer) push(state []byte) {
+	if len(state) != len(r.latest) {
+		// The snapshots can not be compared, so start again.
+		r.start, r.count, r.size = 0, 0, 0
+		r.latest = append(r.latest[:0], state...)
+		r.sinceSnapshot = 0
+		return
+	}
+
+	r.scratch = xorBytes(r.scratch, r.latest, state)
+	var compressed bytes.Buffer
+	w, _ := flate.NewWriter(&compressed, flate.BestSpeed)
+	w.Write(r.scratch)
+	w.Close()
+	r.pushDelta(compressed.Bytes())
+
+	copy(r.latest, state)
+	r.sinceSnapshot = 0
+
+	for r.count > 0 && r.size+len(r.latest) > r.budget {
+		r.dropOldest()
+	}
+}
+
+// pop goes back to the snapshot before the newest one. It returns false if
+// there are no older snapshots, or the delta to it can not be decompressed,
+// in which case the buffer is left as it was.
+func (r *rewindBuffer) pop() bool {
+	if r.count == 0 {
+		return false
+	}
+	index := (r.start + r.count - 1) % len(r.deltas)
+	delta := r.deltas[index]
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(delta)))
+	if err != nil || len(data) != len(r.latest) {
+		return false
+	}
+
+	r.count--
+	r.deltas[index] = nil
+	r.size -= len(delta)
+	r.latest = xorBytes(r.latest, r.latest, data)
+	return true
+}
+
+func (r *rewindBuffer) pushDelta(delta []byte) {
+	if r.count == len(r.deltas) {
+		// Grow the ring, unwrapping it so the oldest is first.
+		grown := make([][]byte, len(r.deltas)*2)
+		for i := 0; i < r.count; i++ {
+			grown[i] = r.deltas[(r.start+i)%len(r.deltas)]
+		}
+		r.deltas = grown
+		r.start = 0
+	}
+	r.deltas[(r.start+r.count)%len(r.deltas)] = delta
+	r.count++
+	r.size += len(delta)
+}
+
+func (r *rewindBuffer) dropOldest() {
+	r.size -= len(r.deltas[r.start])
+	r.deltas[r.start] = nil
+	r.start = (r.start + 1) % len(r.deltas)
+	r.count--
+}
+
+// xorBytes sets dst to a XOR b and returns it, growing dst if needed.
+func xorBytes(dst, a, b []byte) []byte {
+	if cap(dst) < len(a) {
+		dst = make([]byte, len(a))
+	}
+	dst = dst[:len(a)]
+	for i := range a {
+		dst[i] = a[i] ^ b[i]
+	}
+	return dst
+}
+
+// EnableRewind starts keeping snapshots to rewind to, one every interval
+// frames, using up to budget bytes of memory. A budget of 0 turns rewinding
+// off.
+func (gb *Gameboy) EnableRewind(budget, interval int) {
+	if budget <= 0 {
+		gb.rewind = nil
+		return
+	}
+	gb.rewind = newRewindBuffer(budget, interval)
+}
+
+// Rewind goes back by a number of frames. The machine is loaded from the
+// snapshot at or before the frame, and the frames from the snapshot to it
+// are run again, with the input as it was in the snapshot. It returns the
+// number of frames actually gone back, which is less than frames if there
+// are not enough snapshots left and 0 if rewinding is off.
+func (gb *Gameboy) Rewind(frames int) int {
+	r := gb.rewind
+	if r == nil || r.latest == nil || frames <= 0 {
+		return 0
+	}
+
+	for frames > r.sinceSnapshot {
+		if !r.pop() {
+			frames = r.sinceSnapshot
+			break
+		}
+		r.sinceSnapshot += r.interval
+	}
+	if frames == 0 {
+		return 0
+	}
+	gb.syncState(savestate.NewReader(bytes.NewReader(r.latest)))
+	r.sinceSnapshot -= frames
+	for i := 0; i < r.sinceSnapshot; i++ {
+		gb.runFrame()
+		gb.Sound.Samples()
+	}
+	return frames
+}
+
+// snapshotRewind is called after every frame to take a snapshot for
+// rewinding when one is due.
+func (gb *Gameboy) snapshotRewind() {
+	r := gb.rewind
+	if r == nil {
+		return
+	}
+	r.sinceSnapshot++
+	if r.latest != nil && r.sinceSnapshot < r.interval {
+		return
+	}
+	r.snapshot.Reset()
+	gb.syncState(savestate.NewWriter(&r.snapshot))
+	r.push(r.snapshot.Bytes())
+}
+
+// setRewinding starts or stops rewinding a frame at a time instead of
+// running the game, while the rewind button is held.
+func (gb *Gameboy) setRewinding(on bool) {
+	gb.rewinding = on
+}
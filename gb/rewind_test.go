@@ -0,0 +1,144 @@
+package gb
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// randomStates returns n random snapshots of a size, which do not compress.
+func randomStates(n, size int) [][]byte {
+	rng := rand.New(rand.NewSource(1))
+	states := make([][]byte, n)
+	for i := range states {
+		states[i] = make([]byte, size)
+		rng.Read(states[i])
+	}
+	return states
+}
+
+func TestRewindBufferPushPop(t *testing.T) {
+	// More than the initial size of the ring, so it has to grow
+	states := randomStates(150, 64)
+	r := newRewindBuffer(1<<20, 1)
+	for _, state := range states {
+		r.push(state)
+	}
+	if r.count != len(states)-1 {
+		t.Fatalf("got %d deltas, want %d", r.count, len(states)-1)
+	}
+	for i := len(states) - 2; i >= 0; i-- {
+		if !r.pop() {
+			t.Fatalf("pop to snapshot %d failed", i)
+		}
+		if !bytes.Equal(r.latest, states[i]) {
+			t.Fatalf("snapshot %d is not the one pushed", i)
+		}
+	}
+	if r.pop() {
+		t.Error("popped past the oldest snapshot")
+	}
+	if r.size != 0 {
+		t.Errorf("got size %d with no deltas, want 0", r.size)
+	}
+}
+
+func TestRewindBufferBudget(t *testing.T) {
+	states := randomStates(20, 256)
+	budget := 2048
+	r := newRewindBuffer(budget, 1)
+	for _, state := range states {
+		r.push(state)
+		if r.size+len(r.latest) > budget {
+			t.Fatalf("using %d bytes, over the budget of %d", r.size+len(r.latest), budget)
+		}
+	}
+	if r.count == 0 || r.count >= len(states)-1 {
+		t.Fatalf("got %d deltas, want some of the oldest dropped", r.count)
+	}
+	// The newest snapshots are the ones kept
+	kept := r.count
+	for i := len(states) - 2; i >= len(states)-1-kept; i-- {
+		if !r.pop() || !bytes.Equal(r.latest, states[i]) {
+			t.Fatalf("snapshot %d was not kept", i)
+		}
+	}
+	if r.pop() {
+		t.Error("popped to a dropped snapshot")
+	}
+}
+
+func TestRewindBufferLengthChange(t *testing.T) {
+	r := newRewindBuffer(1<<20, 1)
+	r.push(make([]byte, 16))
+	r.push(make([]byte, 16))
+	state := bytes.Repeat([]byte{1}, 32)
+	r.push(state)
+	if r.count != 0 || r.size != 0 {
+		t.Errorf("got %d deltas of %d bytes, want the buffer started again", r.count, r.size)
+	}
+	if !bytes.Equal(r.latest, state) {
+		t.Error("the newest snapshot is not the one pushed")
+	}
+	if r.pop() {
+		t.Error("popped to a snapshot of a different length")
+	}
+}
+
+func TestRewindBufferBadDelta(t *testing.T) {
+	states := randomStates(2, 64)
+	r := newRewindBuffer(1<<20, 1)
+	r.push(states[0])
+	r.push(states[1])
+	good := r.deltas[0]
+	r.deltas[0] = []byte{0xFF, 0xFF}
+	if r.pop() {
+		t.Fatal("popped a delta which does not decompress")
+	}
+	if r.count != 1 || !bytes.Equal(r.latest, states[1]) {
+		t.Fatal("a failed pop changed the buffer")
+	}
+	r.deltas[0] = good
+	if !r.pop() || !bytes.Equal(r.latest, states[0]) {
+		t.Error("pop failed after restoring the delta")
+	}
+}
+
+func TestRewindFrameByFrame(t *testing.T) {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x100:], []byte{
+		0x3C,       // 0100 inc a
+		0x18, 0xFD, // 0101 jr $0100
+	})
+	gameboy, err := New(Options{ROM: rom, RewindBudget: 1 << 20, RewindInterval: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var states [][]byte
+	for i := 0; i < 10; i++ {
+		gameboy.Update()
+		var state bytes.Buffer
+		if err := gameboy.SaveState(&state); err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, state.Bytes())
+	}
+
+	frame := len(states) - 1
+	for _, back := range []int{1, 1, 3, 1} {
+		if got := gameboy.Rewind(back); got != back {
+			t.Fatalf("rewound %d frames, want %d", got, back)
+		}
+		frame -= back
+		var state bytes.Buffer
+		if err := gameboy.SaveState(&state); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(state.Bytes(), states[frame]) {
+			t.Fatalf("the state after rewinding to frame %d is not the one the frame had", frame)
+		}
+	}
+	if got := gameboy.Rewind(10); got != frame {
+		t.Errorf("rewound %d frames, want %d to the oldest snapshot", got, frame)
+	}
+}
@@ -0,0 +1,26 @@
+package gb
+
+import "time"
+
+// UseVirtualRTC makes the cart's real time clock count the emulated time,
+// starting from epoch, instead of the time on the host. This makes the clock
+// the same every time the game is run, for replaying recorded inputs.
+func (gb *Gameboy) UseVirtualRTC(epoch time.Time) {
+	gb.Memory.Cart.UseVirtualClock(epoch)
+}
+
+// RTC returns the time on the cart's real time clock since day 0.
+func (gb *Gameboy) RTC() time.Duration {
+	return gb.Memory.Cart.RTC()
+}
+
+// SetRTC sets the cart's real time clock to a time since day 0.
+func (gb *Gameboy) SetRTC(elapsed time.Duration) {
+	gb.Memory.Cart.SetRTC(elapsed)
+}
+
+// OffsetRTC moves the cart's real time clock forwards, or backwards if the
+// offset is negative.
+func (gb *Gameboy) OffsetRTC(offset time.Duration) {
+	gb.Memory.Cart.OffsetRTC(offset)
+}
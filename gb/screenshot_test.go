@@ -0,0 +1,264 @@
+package gb
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	screenshotDir = flag.String("screenshot.dir", "..", "directory the roms and reference images in the screenshot manifest are relative to")
+	screenshotOut = flag.String("screenshot.out", filepath.Join(os.TempDir(), "gameboy-screenshots"), "directory the screenshots and diffs of failed screenshot tests are written to")
+)
+
+// screenshotManifest lists the ROMs to compare with reference images.
+const screenshotManifest = "testdata/screenshots.txt"
+
+// screenshotTimeout is the number of emulated seconds a ROM has to reach its
+// software breakpoint.
+const screenshotTimeout = 20
+
+// dmgShades are the colours of the 4 DMG shades in reference images.
+var dmgShades = []color.RGBA{
+	{0xFF, 0xFF, 0xFF, 0xFF},
+	{0xAA, 0xAA, 0xAA, 0xFF},
+	{0x55, 0x55, 0x55, 0xFF},
+	{0x00, 0x00, 0x00, 0xFF},
+}
+
+// screenshotTest is a line of the manifest.
+type screenshotTest struct {
+	rom, reference string
+	cgb            bool
+	// Number of frames to run, or 0 to run until LD B,B.
+	frames int
+	// fiveBit compares only the top 5 bits of each channel, for CGB
+	// reference images made by emulators which scale the 5 bit colours to 8
+	// bits differently.
+	fiveBit bool
+}
+
+func TestScreenshots(t *testing.T) {
+	tests, err := readScreenshotManifest(screenshotManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.rom, func(t *testing.T) {
+			rom, err := os.ReadFile(filepath.Join(*screenshotDir, test.rom))
+			if os.IsNotExist(err) {
+				t.Skip(err)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			reference, err := readPNG(filepath.Join(*screenshotDir, test.reference))
+			if os.IsNotExist(err) {
+				t.Skip(err)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Parallel()
+
+			gameboy, err := New(Options{ROM: rom, CGB: test.cgb})
+			if err != nil {
+				t.Fatal(err)
+			}
+			screenshot, err := runScreenshot(gameboy, test.frames)
+			if err != nil {
+				t.Fatal(err)
+			}
+			diff, different := diffImages(screenshot, reference, test.fiveBit)
+			if different == 0 {
+				return
+			}
+
+			// Keep the directories of the rom so roms with the same name
+			// do not overwrite each other's files
+			name := filepath.FromSlash(strings.TrimSuffix(test.rom, filepath.Ext(test.rom)))
+			actualFile := filepath.Join(*screenshotOut, name+"-actual.png")
+			diffFile := filepath.Join(*screenshotOut, name+"-diff.png")
+			if err := writePNG(actualFile, screenshot); err != nil {
+				t.Fatal(err)
+			}
+			if err := writePNG(diffFile, diff); err != nil {
+				t.Fatal(err)
+			}
+			t.Errorf("%d pixels differ from %s, wrote %s and %s", different, test.reference, actualFile, diffFile)
+		})
+	}
+}
+
+func TestDiffImages(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	b := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	a.Set(1, 1, color.RGBA{0x29, 0x29, 0x29, 0xFF})
+	b.Set(1, 1, color.RGBA{0x2C, 0x2C, 0x2C, 0xFF}) // The same 5 bit colour
+	a.Set(3, 0, color.White)
+
+	tests := []struct {
+		name      string
+		fiveBit   bool
+		different int
+		matching  bool
+	}{
+		{"exact", false, 2, false},
+		{"5 bit", true, 1, true},
+	}
+	for _, test := range tests {
+		diff, different := diffImages(a, b, test.fiveBit)
+		if different != test.different {
+			t.Errorf("%s: got %d different pixels, want %d", test.name, different, test.different)
+		}
+		if got := diff.RGBAAt(3, 0); got != diffColour {
+			t.Errorf("%s: got %v for the different pixel, want %v", test.name, got, diffColour)
+		}
+		if got := diff.RGBAAt(1, 1); (got != diffColour) != test.matching {
+			t.Errorf("%s: got %v for the pixel with the same 5 bit colour", test.name, got)
+		}
+	}
+}
+
+// runScreenshot runs a game for a number of frames, or until LD B,B and then
+// for a frame so the whole screen has been drawn, and returns the screen.
+// The DMG shades are shown in the colours of the reference images instead of
+// the current palette.
+func runScreenshot(gameboy *Gameboy, frames int) (*image.RGBA, error) {
+	if frames == 0 {
+		if err := runToBreakpoint(gameboy, screenshotTimeout); err != nil {
+			return nil, err
+		}
+		frames = 1
+	}
+	for i := 0; i < frames; i++ {
+		gameboy.Update()
+	}
+
+	img := gameboy.Framebuffer()
+	if gameboy.IsCGB() {
+		return img, nil
+	}
+	for i := 0; i < len(img.Pix); i += 4 {
+		for shade, col := range Palettes[CurrentPalette] {
+			if img.Pix[i] == col[0] && img.Pix[i+1] == col[1] && img.Pix[i+2] == col[2] {
+				c := dmgShades[shade]
+				img.Pix[i], img.Pix[i+1], img.Pix[i+2] = c.R, c.G, c.B
+				break
+			}
+		}
+	}
+	return img, nil
+}
+
+// diffColour marks the pixels which differ in a diff image.
+var diffColour = color.RGBA{0xFF, 0x00, 0xFF, 0xFF}
+
+// diffImages compares a screenshot with a reference image and returns the
+// number of pixels which differ, and an image of the reference faded out
+// with the different pixels in diffColour. The colours must match exactly,
+// or only in the top 5 bits of each channel if fiveBit is set.
+func diffImages(screenshot, reference image.Image, fiveBit bool) (*image.RGBA, int) {
+	var shift uint8
+	if fiveBit {
+		shift = 3
+	}
+	bounds := screenshot.Bounds().Union(reference.Bounds())
+	diff := image.NewRGBA(bounds)
+	different := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			a := color.RGBAModel.Convert(screenshot.At(x, y)).(color.RGBA)
+			b := color.RGBAModel.Convert(reference.At(x, y)).(color.RGBA)
+			inside := image.Pt(x, y).In(screenshot.Bounds()) && image.Pt(x, y).In(reference.Bounds())
+			if !inside || a.R>>shift != b.R>>shift || a.G>>shift != b.G>>shift || a.B>>shift != b.B>>shift {
+				diff.SetRGBA(x, y, diffColour)
+				different++
+				continue
+			}
+			diff.SetRGBA(x, y, color.RGBA{b.R/4 + 0xC0, b.G/4 + 0xC0, b.B/4 + 0xC0, 0xFF})
+		}
+	}
+	return diff, different
+}
+
+// readScreenshotManifest reads the screenshot tests, where each line is the
+// ROM and the reference image followed by "cgb" to run it in colour mode,
+// "frames=n" to run it for n frames instead of until LD B,B and "5bit" to
+// compare the colours of a CGB test in 5 bits.
+func readScreenshotManifest(filename string) ([]screenshotTest, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tests []screenshotTest
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected rom reference [cgb] [frames=n] [5bit]", filename, line)
+		}
+		test := screenshotTest{rom: fields[0], reference: fields[1]}
+		for _, option := range fields[2:] {
+			switch {
+			case option == "cgb":
+				test.cgb = true
+			case strings.HasPrefix(option, "frames="):
+				frames := strings.TrimPrefix(option, "frames=")
+				n, err := strconv.Atoi(frames)
+				if err != nil || n < 1 {
+					return nil, fmt.Errorf("%s:%d: invalid frames %q", filename, line, frames)
+				}
+				test.frames = n
+			case option == "5bit":
+				test.fiveBit = true
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown option %q", filename, line, option)
+			}
+		}
+		if test.fiveBit && !test.cgb {
+			// DMG shades are compared exactly
+			return nil, fmt.Errorf("%s:%d: 5bit is only for cgb tests", filename, line)
+		}
+		tests = append(tests, test)
+	}
+	return tests, scanner.Err()
+}
+
+func readPNG(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+func writePNG(filename string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,32 @@
+package gb
+
+import (
+	"io"
+	"log"
+)
+
+// SetSerialOutput sets where the bytes the game sends over the link cable
+// are written, or nil to discard them. Test ROMs print their results this way.
+func (gb *Gameboy) SetSerialOutput(w io.Writer) {
+	gb.serialOutput = w
+}
+
+// writeSerialControl starts a transfer over the link cable when the game sets
+// the start bit with the internal clock selected. Nothing is ever connected,
+// so the byte sent is passed to the serial output and 0xFF is received. The
+// transfer finishes straight away instead of after 8 serial clocks.
+func (gb *Gameboy) writeSerialControl(value byte) {
+	gb.Memory.Hram[SC-0xFF00] = value | 0x7E
+	if value&0x81 != 0x81 {
+		return
+	}
+	if gb.serialOutput != nil {
+		if _, err := gb.serialOutput.Write([]byte{gb.Memory.Hram[SB-0xFF00]}); err != nil {
+			log.Printf("Failed to write serial output: %v", err)
+			gb.serialOutput = nil
+		}
+	}
+	gb.Memory.Hram[SB-0xFF00] = 0xFF
+	gb.Memory.Hram[SC-0xFF00] &^= 0x80
+	gb.requestInterrupt(3)
+}
@@ -0,0 +1,207 @@
+package gb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SlotCount is the number of quick save slots for each game, numbered from 1.
+const SlotCount = 10
+
+// slotMagic identifies a save slot file.
+const slotMagic = "GBSLOT\x00\x00"
+
+// slotHeader is written at the start of a save slot file. It is followed by
+// the PNG thumbnail and then the save state.
+type slotHeader struct {
+	Magic [8]byte
+	// Time the state was saved, in nanoseconds since the Unix epoch.
+	Time int64
+	// Size of the PNG thumbnail in bytes.
+	ThumbnailSize uint32
+}
+
+// SlotInfo describes the state saved in a slot.
+type SlotInfo struct {
+	Slot      int
+	Path      string
+	Time      time.Time
+	Size      int64
+	Thumbnail image.Image
+}
+
+// StateDir returns the directory the save slots of a ROM are kept in, which
+// is next to the ROM with a .states extension.
+func StateDir(romFile string) string {
+	return strings.TrimSuffix(romFile, filepath.Ext(romFile)) + ".states"
+}
+
+// slotPath returns the path of a save slot file.
+func slotPath(romFile string, slot int) string {
+	return filepath.Join(StateDir(romFile), fmt.Sprintf("slot%d.state", slot))
+}
+
+// slotPath returns the path of one of the save slot files for the game.
+func (gb *Gameboy) slotPath(slot int) (string, error) {
+	if slot < 1 || slot > SlotCount {
+		return "", fmt.Errorf("invalid save slot %d, expected 1-%d", slot, SlotCount)
+	}
+	romFile := gb.Memory.Cart.Filename()
+	if romFile == "" {
+		return "", errors.New("save slots need the game to be loaded from a file")
+	}
+	return slotPath(romFile, slot), nil
+}
+
+// SaveSlot saves the state of the machine to one of the quick save slots,
+// along with a thumbnail of the screen.
+func (gb *Gameboy) SaveSlot(slot int) error {
+	path, err := gb.slotPath(slot)
+	if err != nil {
+		return err
+	}
+
+	var thumbnail, state bytes.Buffer
+	if err := png.Encode(&thumbnail, gb.Framebuffer()); err != nil {
+		return fmt.Errorf("failed to save slot %d: %w", slot, err)
+	}
+	if err := gb.SaveState(&state); err != nil {
+		return fmt.Errorf("failed to save slot %d: %w", slot, err)
+	}
+
+	header := slotHeader{
+		Time:          time.Now().UnixNano(),
+		ThumbnailSize: uint32(thumbnail.Len()),
+	}
+	copy(header.Magic[:], slotMagic)
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, &header)
+	data.Write(thumbnail.Bytes())
+	data.Write(state.Bytes())
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to save slot %d: %w", slot, err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to save slot %d: %w", slot, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to save slot %d: %w", slot, err)
+	}
+	return nil
+}
+
+// LoadSlot loads the state saved in one of the quick save slots.
+func (gb *Gameboy) LoadSlot(slot int) error {
+	path, err := gb.slotPath(slot)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to load slot %d: %w", slot, err)
+	}
+	defer f.Close()
+
+	header, err := readSlotHeader(f)
+	if err != nil {
+		return fmt.Errorf("failed to load slot %d: %w", slot, err)
+	}
+	if _, err := f.Seek(int64(header.ThumbnailSize), io.SeekCurrent); err != nil {
+		return fmt.Errorf("failed to load slot %d: %w", slot, err)
+	}
+	if err := gb.LoadState(f); err != nil {
+		return fmt.Errorf("failed to load slot %d: %w", slot, err)
+	}
+	return nil
+}
+
+func readSlotHeader(r io.Reader) (*slotHeader, error) {
+	var header slotHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if string(header.Magic[:]) != slotMagic {
+		return nil, errors.New("not a save slot file")
+	}
+	return &header, nil
+}
+
+// ListSlots returns the information about each of the slots of a ROM which
+// have a state saved in them.
+func ListSlots(romFile string) ([]SlotInfo, error) {
+	var slots []SlotInfo
+	for slot := 1; slot <= SlotCount; slot++ {
+		path := slotPath(romFile, slot)
+		info, err := readSlotInfo(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read slot %d: %w", slot, err)
+		}
+		info.Slot = slot
+		slots = append(slots, *info)
+	}
+	return slots, nil
+}
+
+func readSlotInfo(path string) (*SlotInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	header, err := readSlotHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	thumbnail, err := png.Decode(io.LimitReader(f, int64(header.ThumbnailSize)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read thumbnail: %w", err)
+	}
+	return &SlotInfo{
+		Path:      path,
+		Time:      time.Unix(0, header.Time),
+		Size:      stat.Size(),
+		Thumbnail: thumbnail,
+	}, nil
+}
+
+// saveSlotHandler and loadSlotHandler return the key handlers for a slot,
+// which log the result as there is nowhere else to report it.
+func (gb *Gameboy) saveSlotHandler(slot int) func() {
+	return func() {
+		if err := gb.SaveSlot(slot); err != nil {
+			log.Print(err)
+			return
+		}
+		log.Printf("Saved state to slot %d", slot)
+	}
+}
+
+func (gb *Gameboy) loadSlotHandler(slot int) func() {
+	return func() {
+		if err := gb.LoadSlot(slot); err != nil {
+			log.Print(err)
+			return
+		}
+		log.Printf("Loaded state from slot %d", slot)
+	}
+}
@@ -0,0 +1,217 @@
+package gb
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	sm83Dir = flag.String("sm83.dir", "testdata/sm83", "directory of the SM83 single step tests, one json file for each opcode")
+	sm83All = flag.Bool("sm83.all", false, "also run the SM83 tests of the opcodes which are known to fail")
+)
+
+// sm83KnownFailures are the opcodes which are known to fail, by the name of
+// their test file, and why. Only a few opcodes are checked in to testdata, so
+// these apply when -sm83.dir is a full checkout of the tests.
+var sm83KnownFailures = map[string]string{
+	"e0": "takes 8 cycles instead of 12",
+	"ea": "takes 12 cycles instead of 16",
+}
+
+// sm83Failures is the number of failures reported for each opcode before the
+// rest of its tests are skipped.
+const sm83Failures = 5
+
+// sm83Test is a test of a single instruction, in the format of the community
+// single step tests. Each cycle on the bus is an address, a value and what
+// the pins were doing, such as "r-m" for a memory read.
+type sm83Test struct {
+	Name    string      `json:"name"`
+	Initial sm83State   `json:"initial"`
+	Final   sm83State   `json:"final"`
+	Cycles  []sm83Cycle `json:"cycles"`
+}
+
+// sm83Cycle is a cycle on the bus. The value is null for idle cycles, where
+// the pins are "---".
+type sm83Cycle struct {
+	Address uint16
+	Value   *byte
+	Pins    string
+}
+
+func (c *sm83Cycle) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &[]interface{}{&c.Address, &c.Value, &c.Pins})
+}
+
+// sm83State is the state of the CPU and the memory it uses.
+type sm83State struct {
+	A   byte   `json:"a"`
+	B   byte   `json:"b"`
+	C   byte   `json:"c"`
+	D   byte   `json:"d"`
+	E   byte   `json:"e"`
+	F   byte   `json:"f"`
+	H   byte   `json:"h"`
+	L   byte   `json:"l"`
+	PC  uint16 `json:"pc"`
+	SP  uint16 `json:"sp"`
+	IME *byte  `json:"ime"`
+	// Address and value pairs.
+	RAM [][2]uint16 `json:"ram"`
+}
+
+func TestSM83(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(*sm83Dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no tests in %s", *sm83Dir)
+	}
+	for _, file := range files {
+		file := file
+		opcode := strings.TrimSuffix(filepath.Base(file), ".json")
+		t.Run(opcode, func(t *testing.T) {
+			if reason, ok := sm83KnownFailures[opcode]; ok && !*sm83All {
+				t.Skip(reason)
+			}
+			t.Parallel()
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var tests []sm83Test
+			if err := json.Unmarshal(data, &tests); err != nil {
+				t.Fatal(err)
+			}
+
+			bus := &flatBus{}
+			failures := 0
+			for _, test := range tests {
+				if err := runSM83(bus, test); err != nil {
+					t.Errorf("%s: %v", test.Name, err)
+					if failures++; failures == sm83Failures {
+						t.Fatalf("stopping after %d failures", failures)
+					}
+				}
+			}
+		})
+	}
+}
+
+// runSM83 runs a single step test on a CPU using a flat bus.
+func runSM83(bus *flatBus, test sm83Test) error {
+	bus.clear()
+	for _, entry := range test.Initial.RAM {
+		bus.Write(entry[0], byte(entry[1]))
+	}
+	bus.accesses = bus.accesses[:0]
+	z := &Z80{Bus: bus}
+	s := test.Initial
+	z.A, z.B, z.C, z.D, z.E, z.F, z.H, z.L = s.A, s.B, s.C, s.D, s.E, s.F, s.H, s.L
+	z.PC, z.SP = s.PC, s.SP
+	z.IME = s.IME != nil && *s.IME != 0
+	z.setFlagsFromF()
+	z.setBC()
+	z.setDE()
+	z.setHL()
+
+	z.ExecuteInstruction(z.fetch(z.PC))
+
+	var errs []string
+	check := func(name string, got, want uint16) {
+		if got != want {
+			errs = append(errs, fmt.Sprintf("%s = %02X, want %02X", name, got, want))
+		}
+	}
+	f := test.Final
+	check("A", uint16(z.A), uint16(f.A))
+	check("F", uint16(z.F), uint16(f.F))
+	check("B", uint16(z.B), uint16(f.B))
+	check("C", uint16(z.C), uint16(f.C))
+	check("D", uint16(z.D), uint16(f.D))
+	check("E", uint16(z.E), uint16(f.E))
+	check("H", uint16(z.H), uint16(f.H))
+	check("L", uint16(z.L), uint16(f.L))
+	check("PC", z.PC, f.PC)
+	check("SP", z.SP, f.SP)
+	if f.IME != nil && z.IME != (*f.IME != 0) {
+		errs = append(errs, fmt.Sprintf("IME = %v, want %v", z.IME, *f.IME != 0))
+	}
+	for _, entry := range f.RAM {
+		check(fmt.Sprintf("[%04X]", entry[0]), uint16(bus.ram[entry[0]]), entry[1])
+	}
+	if want := len(test.Cycles) * 4; want > 0 && z.M != want {
+		errs = append(errs, fmt.Sprintf("%d cycles, want %d", z.M, want))
+	}
+	var want []busAccess
+	for _, cycle := range test.Cycles {
+		if cycle.Pins == "---" || cycle.Value == nil {
+			continue
+		}
+		want = append(want, busAccess{
+			Address: cycle.Address,
+			Value:   *cycle.Value,
+			Write:   strings.Contains(cycle.Pins, "w"),
+		})
+	}
+	if len(test.Cycles) > 0 && fmt.Sprint(bus.accesses) != fmt.Sprint(want) {
+		errs = append(errs, fmt.Sprintf("bus accesses %v, want %v", bus.accesses, want))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// busAccess is a read or write of a value on the bus.
+type busAccess struct {
+	Address uint16
+	Value   byte
+	Write   bool
+}
+
+func (a busAccess) String() string {
+	if a.Write {
+		return fmt.Sprintf("write [%04X] = %02X", a.Address, a.Value)
+	}
+	return fmt.Sprintf("read [%04X] = %02X", a.Address, a.Value)
+}
+
+// flatBus is 64 KiB of RAM with nothing mapped into it.
+type flatBus struct {
+	ram [0x10000]byte
+	// Addresses written since the bus was cleared.
+	written []uint16
+	// The reads and writes in the order they were made.
+	accesses []busAccess
+}
+
+func (b *flatBus) Read(address uint16) byte {
+	b.accesses = append(b.accesses, busAccess{Address: address, Value: b.ram[address]})
+	return b.ram[address]
+}
+
+func (b *flatBus) Write(address uint16, value byte) {
+	b.ram[address] = value
+	b.written = append(b.written, address)
+	b.accesses = append(b.accesses, busAccess{Address: address, Value: value, Write: true})
+}
+
+// Tick does nothing as there is nothing else on the bus.
+func (b *flatBus) Tick(cycles int) {}
+
+// clear zeroes the memory written since the last clear, which includes the
+// memory a test starts with.
+func (b *flatBus) clear() {
+	for _, address := range b.written {
+		b.ram[address] = 0
+	}
+	b.written = b.written[:0]
+}
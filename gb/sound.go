@@ -0,0 +1,73 @@
+package gb
+
+import (
+	"fmt"
+	"gameboy/apu"
+	"gameboy/audio"
+	"log"
+	"time"
+)
+
+// AudioSamples returns the interleaved stereo samples, at apu.SampleRate,
+// which were generated during the last call to Update.
+func (gb *Gameboy) AudioSamples() []int16 {
+	return gb.audioFrame
+}
+
+// collectAudio takes the samples generated during a frame from the APU and
+// passes them on to the recording if there is one.
+func (gb *Gameboy) collectAudio() {
+	gb.audioFrame = gb.Sound.Samples()
+	if gb.audioRecorder == nil {
+		return
+	}
+	if err := gb.audioRecorder.Write(gb.audioFrame); err != nil {
+		log.Printf("Failed to record audio: %v", err)
+		gb.StopAudioRecording()
+	}
+}
+
+// StartAudioRecording starts recording the sound to a file. A filename with
+// a .wav extension is recorded as a WAV file, anything else as raw 16-bit
+// little endian stereo PCM.
+func (gb *Gameboy) StartAudioRecording(filename string) error {
+	if err := gb.StopAudioRecording(); err != nil {
+		return err
+	}
+	recorder, err := audio.NewRecorder(filename, apu.SampleRate)
+	if err != nil {
+		return fmt.Errorf("failed to start audio recording: %w", err)
+	}
+	gb.audioRecorder = recorder
+	log.Printf("Recording audio to %v", filename)
+	return nil
+}
+
+// StopAudioRecording stops and closes the current audio recording.
+func (gb *Gameboy) StopAudioRecording() error {
+	if gb.audioRecorder == nil {
+		return nil
+	}
+	err := gb.audioRecorder.Close()
+	gb.audioRecorder = nil
+	log.Print("Stopped recording audio")
+	return err
+}
+
+// IsRecordingAudio returns if the sound is currently being recorded.
+func (gb *Gameboy) IsRecordingAudio() bool {
+	return gb.audioRecorder != nil
+}
+
+// toggleAudioRecording starts or stops recording the sound to a WAV file
+// named after the game.
+func (gb *Gameboy) toggleAudioRecording() {
+	if gb.IsRecordingAudio() {
+		gb.StopAudioRecording()
+		return
+	}
+	filename := fmt.Sprintf("%s-%s.wav", gb.Memory.Cart.GetName(), time.Now().Format("20060102-150405"))
+	if err := gb.StartAudioRecording(filename); err != nil {
+		log.Print(err)
+	}
+}
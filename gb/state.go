@@ -0,0 +1,112 @@
+package gb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gameboy/savestate"
+	"io"
+)
+
+// stateMagic identifies a save state file, and stateVersion is increased
+// whenever the layout of the state changes.
+const (
+	stateMagic   = "GBSTATE\x00"
+	stateVersion = 1
+)
+
+// stateHeader is written at the start of every save state.
+type stateHeader struct {
+	Magic   [8]byte
+	Version uint16
+	// Global checksum from the cartridge header of the game the state was
+	// saved from.
+	Checksum uint16
+}
+
+// SaveState writes a snapshot of the whole machine to w.
+func (gb *Gameboy) SaveState(w io.Writer) error {
+	header := stateHeader{
+		Version:  stateVersion,
+		Checksum: gb.Memory.Cart.Header().GlobalChecksum,
+	}
+	copy(header.Magic[:], stateMagic)
+
+	s := savestate.NewWriter(w)
+	s.Sync(&header)
+	gb.syncState(s)
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
+
+// LoadState restores a snapshot of the machine written by SaveState. The
+// state must have been saved from the same game. If it can not be loaded
+// the machine is left as it was.
+func (gb *Gameboy) LoadState(r io.Reader) error {
+	s := savestate.NewReader(r)
+	var header stateHeader
+	s.Sync(&header)
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	if string(header.Magic[:]) != stateMagic {
+		return errors.New("failed to load state: not a save state")
+	}
+	if header.Version != stateVersion {
+		return fmt.Errorf("failed to load state: unsupported version %d, expected %d", header.Version, stateVersion)
+	}
+	if checksum := gb.Memory.Cart.Header().GlobalChecksum; header.Checksum != checksum {
+		return fmt.Errorf("failed to load state: it was saved from a different game (checksum %04x), not %s (checksum %04x)",
+			header.Checksum, gb.Memory.Cart.GetName(), checksum)
+	}
+
+	// Keep the current state so it can be put back if the state is
+	// truncated part of the way through.
+	var backup bytes.Buffer
+	gb.syncState(savestate.NewWriter(&backup))
+
+	gb.syncState(s)
+	if err := s.Err(); err != nil {
+		gb.syncState(savestate.NewReader(&backup))
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	return nil
+}
+
+// syncState saves or loads the state of every part of the machine.
+func (gb *Gameboy) syncState(s *savestate.State) {
+	gb.CPU.syncState(s)
+	gb.Memory.syncState(s)
+	gb.Memory.Cart.SyncState(s)
+	gb.Sound.SyncState(s)
+
+	// PPU
+	s.Sync(&gb.screenData, &gb.bgPriority, &gb.tileScanline, &gb.scanlineCounter,
+		&gb.screenCleared, &gb.PreparedData)
+	gb.BGPalette.syncState(s)
+	gb.SpritePalette.syncState(s)
+
+	// Timers, interrupts and input
+	s.Sync(&gb.timerCounter, &gb.CPU.Halted, &gb.inputMask)
+
+	// CGB mode and speed
+	s.Sync(&gb.cgbMode, &gb.currentSpeed, &gb.prepareSpeed)
+}
+
+func (z *Z80) syncState(s *savestate.State) {
+	s.Sync(&z.A, &z.B, &z.C, &z.D, &z.E, &z.H, &z.L, &z.F)
+	s.Sync(&z.AF, &z.BC, &z.DE, &z.HL, &z.PC, &z.SP)
+	s.Sync(&z.Z, &z.N, &z.HF, &z.CF)
+	s.Sync(&z.IME, &z.InterruptsEnabling, &z.M, &z.Divider)
+}
+
+func (m *Memory) syncState(s *savestate.State) {
+	s.Sync(&m.Ram, &m.Vram, &m.VramBank, &m.Wram, &m.WramBank, &m.Echo, &m.Oam, &m.Hram)
+	s.Sync(&m.hdmaLength, &m.hdmaActive)
+}
+
+func (pal *cgbPalette) syncState(s *savestate.State) {
+	s.Sync(pal.Palette, &pal.Index, &pal.Inc)
+}
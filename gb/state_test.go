@@ -0,0 +1,105 @@
+package gb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// newStateTestGameboy creates a Gameboy running an MBC3 cart with an RTC,
+// whose code counts up in A. The RTC uses a virtual clock if epoch is set.
+func newStateTestGameboy(t *testing.T, checksum byte, epoch *time.Time) *Gameboy {
+	rom := make([]byte, 0x8000)
+	copy(rom[0x100:], []byte{
+		0x3C,       // 0100 inc a
+		0x18, 0xFD, // 0101 jr $0100
+	})
+	rom[0x147] = 0x10 // MBC3+TIMER+RAM+BATTERY
+	rom[0x149] = 0x03 // 32KB
+	rom[0x14F] = checksum
+	gameboy, err := New(Options{ROM: rom, RTCEpoch: epoch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gameboy
+}
+
+func saveState(t *testing.T, gameboy *Gameboy) []byte {
+	var state bytes.Buffer
+	if err := gameboy.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	return state.Bytes()
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	epoch := time.Unix(0, 0)
+	gameboy := newStateTestGameboy(t, 0, &epoch)
+	gameboy.RunFrame()
+	saved := saveState(t, gameboy)
+	a := gameboy.CPU.A
+
+	gameboy.RunFrame()
+	if err := gameboy.LoadState(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	if gameboy.CPU.A != a {
+		t.Errorf("got A = %02X after loading, want %02X", gameboy.CPU.A, a)
+	}
+	if !bytes.Equal(saveState(t, gameboy), saved) {
+		t.Error("the state after loading is not the one saved")
+	}
+}
+
+func TestStateErrors(t *testing.T) {
+	epoch := time.Unix(0, 0)
+	other := newStateTestGameboy(t, 1, &epoch)
+	other.RunFrame()
+	otherState := saveState(t, other)
+
+	gameboy := newStateTestGameboy(t, 0, &epoch)
+	gameboy.RunFrame()
+	saved := saveState(t, gameboy)
+	gameboy.RunFrame()
+	before := saveState(t, gameboy)
+
+	tests := map[string][]byte{
+		"a different game":  otherState,
+		"a truncated state": saved[:len(saved)/2],
+		"not a save state":  []byte("not a save state at all"),
+	}
+	for name, state := range tests {
+		if err := gameboy.LoadState(bytes.NewReader(state)); err == nil {
+			t.Errorf("loaded %s without an error", name)
+		}
+		if !bytes.Equal(saveState(t, gameboy), before) {
+			t.Errorf("loading %s changed the machine", name)
+		}
+	}
+}
+
+func TestStateClockMode(t *testing.T) {
+	epoch := time.Unix(0, 0)
+	virtual := saveState(t, newStateTestGameboy(t, 0, &epoch))
+	host := saveState(t, newStateTestGameboy(t, 0, nil))
+
+	gameboy := newStateTestGameboy(t, 0, nil)
+	if err := gameboy.LoadState(bytes.NewReader(virtual[:len(virtual)-1])); err == nil {
+		t.Fatal("loaded a truncated state without an error")
+	}
+	if gameboy.Memory.Cart.UsesVirtualClock() {
+		t.Error("a failed load switched to the virtual clock")
+	}
+	if err := gameboy.LoadState(bytes.NewReader(virtual)); err != nil {
+		t.Fatal(err)
+	}
+	if !gameboy.Memory.Cart.UsesVirtualClock() {
+		t.Error("loading a state saved with the virtual clock did not use it")
+	}
+	if err := gameboy.LoadState(bytes.NewReader(host)); err != nil {
+		t.Fatal(err)
+	}
+	if gameboy.Memory.Cart.UsesVirtualClock() {
+		t.Error("loading a state saved with the host's clock kept the virtual clock")
+	}
+}
@@ -0,0 +1,124 @@
+package gb
+
+import (
+	"bufio"
+	"fmt"
+	"gameboy/symbols"
+	"io"
+	"log"
+	"os"
+)
+
+// TraceOptions sets when a trace starts. If StartAtPC is set the trace starts
+// the first time the CPU reaches StartPC, otherwise once StartCycle cycles
+// have been run.
+type TraceOptions struct {
+	StartPC    uint16
+	StartAtPC  bool
+	StartCycle uint64
+
+	// DoctorLY makes the CPU always read 0x90 from LY once the trace has
+	// started, as the reference traces of gameboy-doctor are made with it
+	// stubbed. Before the start the game runs normally.
+	DoctorLY bool
+
+	// Symbols adds the nearest label to PC to the end of each line, such
+	// as " ; Main.loop+$3". The lines can then only be compared with
+	// gameboy-doctor after removing it.
+	Symbols *symbols.Table
+}
+
+// tracer writes a line for each instruction the CPU runs, in the format used
+// by gameboy-doctor, so it can be compared with traces from other emulators.
+type tracer struct {
+	w      *bufio.Writer
+	closer io.Closer
+	opts   TraceOptions
+
+	started bool
+	cycles  uint64
+	err     error
+}
+
+// StartTrace starts writing a trace of the instructions run to w. Each line
+// has the registers before the instruction and the four bytes at PC, such as
+// "A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:00,C3,13,02".
+// The trace is buffered, so StopTrace must be called to write all of it. The
+// writer is left open for the caller to close.
+func (gb *Gameboy) StartTrace(w io.Writer, opts TraceOptions) error {
+	if err := gb.StopTrace(); err != nil {
+		return err
+	}
+	gb.trace = &tracer{
+		w:    bufio.NewWriterSize(w, 1<<16),
+		opts: opts,
+	}
+	return nil
+}
+
+// StartTraceFile starts writing a trace of the instructions run to a file,
+// which is closed by StopTrace.
+func (gb *Gameboy) StartTraceFile(filename string, opts TraceOptions) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to start trace: %w", err)
+	}
+	if err := gb.StartTrace(f, opts); err != nil {
+		f.Close()
+		return err
+	}
+	gb.trace.closer = f
+	return nil
+}
+
+// StopTrace writes the rest of the trace, and closes the file if it was
+// started with StartTraceFile.
+func (gb *Gameboy) StopTrace() error {
+	t := gb.trace
+	if t == nil {
+		return nil
+	}
+	gb.trace = nil
+	if err := t.w.Flush(); err != nil && t.err == nil {
+		t.err = err
+	}
+	if t.closer != nil {
+		if err := t.closer.Close(); err != nil && t.err == nil {
+			t.err = err
+		}
+	}
+	if t.err != nil {
+		return fmt.Errorf("failed to write trace: %w", t.err)
+	}
+	return nil
+}
+
+// instruction writes the line for the instruction which is about to run.
+func (t *tracer) instruction(gb *Gameboy) {
+	z := gb.CPU
+	if !t.started {
+		if t.opts.StartAtPC {
+			t.started = z.PC == t.opts.StartPC
+		} else {
+			t.started = t.cycles >= t.opts.StartCycle
+		}
+		if !t.started {
+			return
+		}
+	}
+	if t.err != nil {
+		return
+	}
+
+	m := gb.Memory
+	fmt.Fprintf(t.w, "A:%02X F:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X PC:%04X PCMEM:%02X,%02X,%02X,%02X",
+		z.A, z.F, z.B, z.C, z.D, z.E, z.H, z.L, z.SP, z.PC,
+		m.ReadByte(z.PC), m.ReadByte(z.PC+1), m.ReadByte(z.PC+2), m.ReadByte(z.PC+3))
+	if label := t.opts.Symbols.Describe(gb.Bank(z.PC), z.PC); label != "" {
+		t.w.WriteString(" ; " + label)
+	}
+	if err := t.w.WriteByte('\n'); err != nil {
+		t.err = err
+		log.Printf("Failed to write trace: %v", err)
+	}
+}
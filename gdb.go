@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gameboy/gb"
+	"gameboy/gdbstub"
+	"log"
+)
+
+// gdbCommand runs a ROM without a window and serves it to debuggers which
+// speak the GDB Remote Serial Protocol.
+func gdbCommand(args []string) error {
+	flags := flag.NewFlagSet("gdb", flag.ExitOnError)
+	address := flags.String("addr", "localhost:2345", "address to listen on")
+	cgb := flags.Bool("cgb", false, "run the game in cgb mode if it supports it")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gameboy gdb [-addr host:port] [-cgb] rom.gb")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected a single rom file")
+	}
+
+	gameboy, err := gb.NewGameboy(flags.Arg(0), *cgb)
+	if err != nil {
+		return err
+	}
+	log.Printf("Waiting for a debugger on %s", *address)
+	return gdbstub.NewServer(gameboy).ListenAndServe(*address)
+}
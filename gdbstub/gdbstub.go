@@ -0,0 +1,445 @@
+// Package gdbstub lets debuggers which speak the GDB Remote Serial Protocol
+// control the emulator over a TCP connection.
+//
+// The registers are sent as AF, BC, DE, HL, SP and PC, each 16 bits in little
+// endian order. The stub supports reading and writing registers and memory,
+// software breakpoints, watchpoints, stepping and continuing, and stopping a
+// running game with Ctrl+C.
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gameboy/gb"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// registers are the names of the registers in the order they are sent.
+var registers = []string{"AF", "BC", "DE", "HL", "SP", "PC"}
+
+// Server serves connections from debuggers for a single machine.
+type Server struct {
+	gb *gb.Gameboy
+	d  *gb.Debugger
+}
+
+// NewServer creates a server which controls the machine. It attaches the
+// machine's debugger.
+func NewServer(gameboy *gb.Gameboy) *Server {
+	return &Server{gb: gameboy, d: gameboy.Debugger()}
+}
+
+// ListenAndServe listens on a TCP address, such as "localhost:2345", and
+// serves debuggers which connect to it one at a time.
+func (s *Server) ListenAndServe(address string) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return s.Serve(l)
+}
+
+// Serve serves the connections accepted by a listener one at a time until
+// the listener is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		log.Printf("Debugger connected from %v", conn.RemoteAddr())
+		if err := s.ServeConn(conn); err != nil {
+			log.Printf("Debugger connection failed: %v", err)
+		}
+		log.Print("Debugger disconnected")
+	}
+}
+
+// ServeConn serves a single debugger until it detaches or disconnects.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) error {
+	c := &session{
+		server:      s,
+		conn:        conn,
+		packets:     make(chan string, 16),
+		done:        make(chan struct{}),
+		watchpoints: make(map[string]int),
+	}
+	defer func() {
+		close(c.done)
+		conn.Close()
+	}()
+	go c.readPackets()
+
+	for packet := range c.packets {
+		if packet == "k" {
+			// Kill has no reply
+			return nil
+		}
+		reply, done := c.handle(packet)
+		if err := c.send(reply); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+	return c.readErr
+}
+
+// session is the connection of a single debugger.
+type session struct {
+	server *Server
+	conn   io.ReadWriteCloser
+
+	// Writes are made from both the reader goroutine, which acknowledges
+	// packets, and the goroutine which handles them.
+	mu    sync.Mutex
+	noAck bool
+	last  string
+
+	packets chan string
+	readErr error
+	// Closed when the session has finished.
+	done chan struct{}
+
+	// The IDs of the breakpoints and watchpoints in the debugger, by the
+	// packet which added them.
+	watchpoints map[string]int
+}
+
+// readPackets reads the packets sent by the debugger and passes them on to
+// be handled. A Ctrl+C byte stops the game straight away.
+func (c *session) readPackets() {
+	defer close(c.packets)
+	r := bufio.NewReader(c.conn)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				c.readErr = err
+			}
+			// Stop the game if it is running, so the session can finish
+			c.server.d.Interrupt()
+			return
+		}
+		switch b {
+		case 0x03:
+			c.server.d.Interrupt()
+		case '-':
+			c.resend()
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				return
+			}
+			sum := make([]byte, 2)
+			if _, err := io.ReadFull(r, sum); err != nil {
+				return
+			}
+			data = strings.TrimSuffix(data, "#")
+			expected, err := strconv.ParseUint(string(sum), 16, 8)
+			if err != nil || byte(expected) != checksum(data) {
+				c.ack('-')
+				continue
+			}
+			c.ack('+')
+			select {
+			case c.packets <- data:
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+func (c *session) ack(b byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.noAck {
+		c.conn.Write([]byte{b})
+	}
+}
+
+// send sends a reply packet.
+func (c *session) send(data string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = data
+	_, err := fmt.Fprintf(c.conn, "$%s#%02x", data, checksum(data))
+	return err
+}
+
+// resend sends the last reply again after the debugger failed to receive it.
+func (c *session) resend() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.conn, "$%s#%02x", c.last, checksum(c.last))
+}
+
+func checksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// handle runs the command in a packet and returns the reply, and if the
+// session has finished.
+func (c *session) handle(packet string) (string, bool) {
+	if packet == "" {
+		return "", false
+	}
+	args := packet[1:]
+	switch packet[0] {
+	case '?':
+		return "S05", false
+	case 'g':
+		return c.readRegisters(), false
+	case 'G':
+		return c.writeRegisters(args), false
+	case 'p':
+		return c.readRegister(args), false
+	case 'P':
+		return c.writeRegister(args), false
+	case 'm':
+		return c.readMemory(args), false
+	case 'M':
+		return c.writeMemory(args), false
+	case 'c':
+		if reply := c.jump(args); reply != "" {
+			return reply, false
+		}
+		return c.stopReply(c.server.d.Continue()), false
+	case 's':
+		if reply := c.jump(args); reply != "" {
+			return reply, false
+		}
+		return c.stopReply(c.server.d.Step()), false
+	case 'Z':
+		return c.addBreakpoint(args), false
+	case 'z':
+		return c.removeBreakpoint(args), false
+	case 'q', 'Q':
+		return c.query(packet), false
+	case 'H':
+		return "OK", false
+	case 'D':
+		return "OK", true
+	}
+	return "", false
+}
+
+func (c *session) query(packet string) string {
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		return "PacketSize=4000;QStartNoAckMode+;swbreak+"
+	case packet == "QStartNoAckMode":
+		// The OK is still acknowledged, so no acks are sent after it
+		defer func() {
+			c.mu.Lock()
+			c.noAck = true
+			c.mu.Unlock()
+		}()
+		return "OK"
+	case packet == "qAttached":
+		return "1"
+	case packet == "qC":
+		return "QC1"
+	case packet == "qfThreadInfo":
+		return "m1"
+	case packet == "qsThreadInfo":
+		return "l"
+	}
+	return ""
+}
+
+// stopReply returns the packet which tells the debugger why the game stopped.
+func (c *session) stopReply(stop gb.Stop) string {
+	switch stop.Reason {
+	case gb.StopBreakpoint:
+		return "T05swbreak:;"
+	case gb.StopWatchpoint:
+		switch stop.Kind {
+		case gb.WatchRead:
+			return fmt.Sprintf("T05rwatch:%x;", stop.Address)
+		case gb.WatchWrite:
+			return fmt.Sprintf("T05watch:%x;", stop.Address)
+		}
+		return "T05swbreak:;"
+	case gb.StopInterrupted:
+		return "S02"
+	}
+	return "S05"
+}
+
+// jump sets the PC to the address a continue or step packet resumes at, if
+// it has one. It returns an error reply if the address is invalid.
+func (c *session) jump(args string) string {
+	if args == "" {
+		return ""
+	}
+	address, err := strconv.ParseUint(args, 16, 16)
+	if err != nil {
+		return "E01"
+	}
+	c.server.gb.CPU.PC = uint16(address)
+	return ""
+}
+
+func (c *session) readRegisters() string {
+	var b strings.Builder
+	for _, name := range registers {
+		value, _ := c.server.gb.CPU.Register(name)
+		fmt.Fprintf(&b, "%02x%02x", byte(value), byte(value>>8))
+	}
+	return b.String()
+}
+
+func (c *session) writeRegisters(args string) string {
+	data, err := hex.DecodeString(args)
+	if err != nil || len(data) < len(registers)*2 {
+		return "E01"
+	}
+	for i, name := range registers {
+		c.server.gb.CPU.SetRegister(name, uint16(data[i*2])|uint16(data[i*2+1])<<8)
+	}
+	return "OK"
+}
+
+func (c *session) readRegister(args string) string {
+	n, err := strconv.ParseUint(args, 16, 8)
+	if err != nil || int(n) >= len(registers) {
+		return "E01"
+	}
+	value, _ := c.server.gb.CPU.Register(registers[n])
+	return fmt.Sprintf("%02x%02x", byte(value), byte(value>>8))
+}
+
+func (c *session) writeRegister(args string) string {
+	number, value, ok := strings.Cut(args, "=")
+	n, err := strconv.ParseUint(number, 16, 8)
+	if !ok || err != nil || int(n) >= len(registers) {
+		return "E01"
+	}
+	data, err := hex.DecodeString(value)
+	if err != nil || len(data) != 2 {
+		return "E01"
+	}
+	c.server.gb.CPU.SetRegister(registers[n], uint16(data[0])|uint16(data[1])<<8)
+	return "OK"
+}
+
+// parseRange parses the "addr,length" arguments of the memory packets.
+func parseRange(args string) (uint16, int, error) {
+	address, length, ok := strings.Cut(args, ",")
+	if !ok {
+		return 0, 0, errors.New("missing length")
+	}
+	a, err := strconv.ParseUint(address, 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, err := strconv.ParseUint(length, 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint16(a), int(n), nil
+}
+
+func (c *session) readMemory(args string) string {
+	address, length, err := parseRange(args)
+	if err != nil {
+		return "E01"
+	}
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = c.server.gb.Memory.ReadByte(address + uint16(i))
+	}
+	return hex.EncodeToString(data)
+}
+
+func (c *session) writeMemory(args string) string {
+	header, value, ok := strings.Cut(args, ":")
+	address, length, err := parseRange(header)
+	if !ok || err != nil {
+		return "E01"
+	}
+	data, err := hex.DecodeString(value)
+	if err != nil || len(data) != length {
+		return "E01"
+	}
+	for i, b := range data {
+		c.server.gb.Memory.WriteByte(address+uint16(i), b)
+	}
+	return "OK"
+}
+
+// watchKinds are the kinds of access of the Z packets which add watchpoints.
+var watchKinds = map[byte]gb.WatchKind{
+	'2': gb.WatchWrite,
+	'3': gb.WatchRead,
+	'4': gb.WatchRead | gb.WatchWrite,
+}
+
+// addBreakpoint adds a breakpoint for a "Ztype,addr,kind" packet. Software
+// and hardware breakpoints are the same, as neither changes the memory.
+func (c *session) addBreakpoint(args string) string {
+	if _, ok := c.watchpoints[args]; ok {
+		return "OK"
+	}
+	kind, address, length, err := parseBreakpoint(args)
+	if err != nil {
+		return "E01"
+	}
+	var id int
+	switch kind {
+	case '0', '1':
+		id, err = c.server.d.AddBreakpoint(&gb.Location{Bank: gb.AnyBank, Address: address}, nil)
+	case '2', '3', '4':
+		end := address
+		if length > 1 {
+			end = address + uint16(length-1)
+		}
+		id, err = c.server.d.AddWatchpoint(address, end, watchKinds[kind])
+	default:
+		return ""
+	}
+	if err != nil {
+		return "E01"
+	}
+	c.watchpoints[args] = id
+	return "OK"
+}
+
+// removeBreakpoint removes the breakpoint added by a Z packet with the same
+// arguments.
+func (c *session) removeBreakpoint(args string) string {
+	id, ok := c.watchpoints[args]
+	if !ok {
+		return "OK"
+	}
+	delete(c.watchpoints, args)
+	if err := c.server.d.Delete(id); err != nil {
+		return "E01"
+	}
+	return "OK"
+}
+
+// parseBreakpoint parses the "type,addr,kind" arguments of a Z packet.
+func parseBreakpoint(args string) (byte, uint16, int, error) {
+	parts := strings.Split(args, ",")
+	if len(parts) != 3 || len(parts[0]) != 1 {
+		return 0, 0, 0, errors.New("invalid breakpoint")
+	}
+	address, length, err := parseRange(parts[1] + "," + parts[2])
+	return parts[0][0], address, length, err
+}
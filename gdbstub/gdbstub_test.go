@@ -0,0 +1,177 @@
+package gdbstub
+
+import (
+	"bufio"
+	"fmt"
+	"gameboy/gb"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProgram is run from 0x0100 by the test ROM.
+var testProgram = []byte{
+	0x00,       // 0100 nop
+	0x3E, 0x42, //       0101 ld a, $42
+	0x06, 0x07, //       0103 ld b, $07
+	0x04,             // 0105 inc b
+	0xEA, 0x00, 0xC0, // 0106 ld [$C000], a
+	0x18, 0xFE, //       0109 jr $0109
+}
+
+// newTestGameboy returns a machine running a 32 KiB ROM with testProgram.
+func newTestGameboy(t *testing.T) *gb.Gameboy {
+	t.Helper()
+	rom := make([]byte, 0x8000)
+	copy(rom[0x100:], testProgram)
+	copy(rom[0x134:], "GDBSTUB")
+	gameboy, err := gb.New(gb.Options{ROM: rom})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gameboy
+}
+
+// client is a minimal GDB client.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// startServer serves a machine on a local port and connects a client to it.
+func startServer(t *testing.T, gameboy *gb.Gameboy) *client {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go NewServer(gameboy).Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// call sends a packet and returns the reply.
+func (c *client) call(packet string) string {
+	c.t.Helper()
+	c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := fmt.Fprintf(c.conn, "$%s#%02x", packet, checksum(packet)); err != nil {
+		c.t.Fatal(err)
+	}
+	if ack, err := c.r.ReadByte(); err != nil || ack != '+' {
+		c.t.Fatalf("%s: expected an ack, got %q (%v)", packet, ack, err)
+	}
+	return c.reply()
+}
+
+// reply reads a reply packet and acknowledges it.
+func (c *client) reply() string {
+	c.t.Helper()
+	if _, err := c.r.ReadString('$'); err != nil {
+		c.t.Fatal(err)
+	}
+	data, err := c.r.ReadString('#')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	data = strings.TrimSuffix(data, "#")
+	var sum byte
+	if _, err := fmt.Fscanf(c.r, "%02x", &sum); err != nil || sum != checksum(data) {
+		c.t.Fatalf("bad checksum for %q", data)
+	}
+	c.conn.Write([]byte{'+'})
+	return data
+}
+
+func (c *client) expect(packet, want string) {
+	c.t.Helper()
+	if got := c.call(packet); got != want {
+		c.t.Errorf("%s: got %q, want %q", packet, got, want)
+	}
+}
+
+func TestRegistersAndMemory(t *testing.T) {
+	gameboy := newTestGameboy(t)
+	c := startServer(t, gameboy)
+
+	if got := c.call("qSupported:swbreak+"); !strings.Contains(got, "PacketSize=") {
+		t.Errorf("qSupported: got %q", got)
+	}
+	c.expect("?", "S05")
+	// AF=01B0 BC=0013 DE=00D8 HL=014D SP=FFFE PC=0100 after the boot ROM
+	c.expect("g", "b0011300d8004d01feff0001")
+	c.expect("p5", "0001")
+	c.expect("m100,4", "003e4206")
+
+	c.expect("P1=3412", "OK")
+	if gameboy.CPU.B != 0x12 || gameboy.CPU.C != 0x34 {
+		t.Errorf("BC is %02X%02X after writing it, want 1234", gameboy.CPU.B, gameboy.CPU.C)
+	}
+	c.expect("Gf001100220033004fcff0201", "OK")
+	c.expect("g", "f001100220033004fcff0201")
+	if !gameboy.CPU.Z || !gameboy.CPU.CF {
+		t.Error("flags were not set from F")
+	}
+
+	c.expect("Mc000,3:aabbcc", "OK")
+	c.expect("mc000,3", "aabbcc")
+	c.expect("p9", "E01")
+	c.expect("vMustReplyEmpty", "")
+	c.expect("D", "OK")
+}
+
+func TestStepAndBreakpoints(t *testing.T) {
+	gameboy := newTestGameboy(t)
+	c := startServer(t, gameboy)
+
+	c.expect("s", "S05")
+	c.expect("s", "S05")
+	c.expect("p5", "0301")
+	if gameboy.CPU.A != 0x42 {
+		t.Errorf("A is %02X after stepping, want 42", gameboy.CPU.A)
+	}
+
+	c.expect("Z0,106,1", "OK")
+	c.expect("c", "T05swbreak:;")
+	c.expect("p5", "0601")
+	if gameboy.CPU.B != 0x08 {
+		t.Errorf("B is %02X at the breakpoint, want 08", gameboy.CPU.B)
+	}
+	c.expect("z0,106,1", "OK")
+
+	c.expect("Z2,c000,1", "OK")
+	c.expect("c", "T05watch:c000;")
+	c.expect("mc000,1", "42")
+	c.expect("z2,c000,1", "OK")
+
+	// Resume at an address
+	c.expect("Z0,103,1", "OK")
+	c.expect("c101", "T05swbreak:;")
+	c.expect("p5", "0301")
+}
+
+func TestInterrupt(t *testing.T) {
+	gameboy := newTestGameboy(t)
+	c := startServer(t, gameboy)
+
+	c.expect("QStartNoAckMode", "OK")
+	if _, err := fmt.Fprintf(c.conn, "$c#%02x", checksum("c")); err != nil {
+		t.Fatal(err)
+	}
+	// Let it reach the loop at the end of the program before stopping it
+	time.Sleep(100 * time.Millisecond)
+	c.conn.Write([]byte{0x03})
+	if got := c.reply(); got != "S02" {
+		t.Errorf("got %q after interrupting, want S02", got)
+	}
+	if pc := gameboy.CPU.PC; pc != 0x0109 {
+		t.Errorf("PC is %04X after interrupting, want 0109", pc)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gameboy/cart"
+	"os"
+)
+
+// infoCommand prints the cartridge header of a ROM.
+func infoCommand(args []string) error {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gameboy info rom.gb")
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected a single rom file")
+	}
+
+	rom, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	header, err := cart.ParseHeader(rom)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Title:           %s\n", header.Title)
+	if header.Manufacturer != "" {
+		fmt.Printf("Manufacturer:    %s\n", header.Manufacturer)
+	}
+	fmt.Printf("CGB flag:        %#02x (%s)\n", header.CGBFlag, cgbSupport(header))
+	fmt.Printf("SGB flag:        %#02x (%s)\n", header.SGBFlag, supported(header.SupportsSGB()))
+	fmt.Printf("Licensee:        %s\n", header.Licensee)
+	fmt.Printf("Cart type:       %#02x (%s)\n", header.CartType, header.CartTypeName())
+	fmt.Printf("ROM size:        %d KB (%d banks)\n", header.ROMSize/1024, header.ROMSize/0x4000)
+	fmt.Printf("RAM size:        %d KB\n", header.RAMSize/1024)
+	fmt.Printf("Version:         %d\n", header.Version)
+	fmt.Printf("Header checksum: %#02x (%s)\n", header.HeaderChecksum, valid(header.ValidHeaderChecksum()))
+	fmt.Printf("Global checksum: %#04x (%s)\n", header.GlobalChecksum, valid(header.ValidGlobalChecksum()))
+	return nil
+}
+
+func cgbSupport(header *cart.Header) string {
+	switch {
+	case header.CGBOnly():
+		return "CGB only"
+	case header.SupportsCGB():
+		return "CGB supported"
+	default:
+		return "DMG only"
+	}
+}
+
+func supported(ok bool) string {
+	if ok {
+		return "supported"
+	}
+	return "not supported"
+}
+
+func valid(ok bool) string {
+	if ok {
+		return "valid"
+	}
+	return "invalid"
+}
@@ -0,0 +1,123 @@
+package io
+
+import (
+	"encoding/binary"
+	"gameboy/apu"
+	"sync"
+
+	"github.com/hajimehoshi/oto"
+)
+
+const (
+	// Number of bytes in each stereo sample.
+	bytesPerSample = 4
+	// Number of bytes of audio in a single frame.
+	frameBytes = apu.SampleRate / 60 * bytesPerSample
+	// Size of the buffer in the oto context.
+	otoBufferBytes = frameBytes * 2
+	// Number of bytes which are queued before playback starts, so small
+	// jitters in the frame timing do not empty the queue.
+	primeBytes = frameBytes * 2
+	// Maximum number of bytes which can be queued. Once this is reached the
+	// oldest audio is dropped so the latency does not keep growing.
+	maxQueuedBytes = frameBytes * 8
+)
+
+// OtoAudioBinding plays the sound through the system's audio device.
+type OtoAudioBinding struct {
+	context *oto.Context
+	player  *oto.Player
+
+	mu     sync.Mutex
+	queue  []byte
+	closed bool
+
+	// The last sample played, which is repeated when the queue runs out
+	// so an underrun does not cause a click.
+	last [bytesPerSample]byte
+
+	done chan struct{}
+}
+
+// NewOtoAudioBinding opens the audio device and starts playing.
+func NewOtoAudioBinding() (*OtoAudioBinding, error) {
+	context, err := oto.NewContext(apu.SampleRate, 2, 2, otoBufferBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	audio := &OtoAudioBinding{
+		context: context,
+		player:  context.NewPlayer(),
+		done:    make(chan struct{}),
+	}
+	go audio.run()
+	return audio, nil
+}
+
+// Play queues a batch of samples to be played.
+func (a *OtoAudioBinding) Play(samples []int16) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, sample := range samples {
+		a.queue = binary.LittleEndian.AppendUint16(a.queue, uint16(sample))
+	}
+	if overflow := len(a.queue) - maxQueuedBytes; overflow > 0 {
+		// Drop whole samples from the front of the queue.
+		overflow += (bytesPerSample - overflow%bytesPerSample) % bytesPerSample
+		a.queue = a.queue[overflow:]
+	}
+}
+
+// run writes the queued audio to the player. The player blocks once its
+// buffer is full, which paces the writes to the speed of the audio device.
+func (a *OtoAudioBinding) run() {
+	defer close(a.done)
+
+	chunk := make([]byte, frameBytes)
+	primed := false
+	for {
+		a.mu.Lock()
+		if a.closed {
+			a.mu.Unlock()
+			return
+		}
+
+		n := 0
+		if primed || len(a.queue) >= primeBytes {
+			primed = true
+			n = copy(chunk, a.queue)
+			a.queue = a.queue[n:]
+			if n > 0 {
+				copy(a.last[:], chunk[n-bytesPerSample:n])
+			}
+		}
+		if n < len(chunk) {
+			// Underrun, hold the last sample until the queue has filled
+			// up enough to start playing again.
+			for i := n; i < len(chunk); i += bytesPerSample {
+				copy(chunk[i:], a.last[:])
+			}
+			primed = false
+		}
+		a.mu.Unlock()
+
+		if _, err := a.player.Write(chunk); err != nil {
+			return
+		}
+	}
+}
+
+// Close stops playback and closes the audio device.
+func (a *OtoAudioBinding) Close() error {
+	a.mu.Lock()
+	a.closed = true
+	a.mu.Unlock()
+	<-a.done
+
+	if err := a.player.Close(); err != nil {
+		return err
+	}
+	return a.context.Close()
+}
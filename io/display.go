@@ -125,6 +125,9 @@ var keyMap = map[pixelgl.Button]gb.Button{
 	pixelgl.Key8:      gb.ButtonToggleSoundChannel2,
 	pixelgl.Key9:      gb.ButtonToggleSoundChannel3,
 	pixelgl.Key0:      gb.ButtonToggleSoundChannel4,
+	pixelgl.KeyR:      gb.ButtonToggleAudioRecording,
+
+	pixelgl.KeyBackslash: gb.ButtonRewind,
 }
 
 // ProcessInput checks the input and process it.
@@ -145,5 +148,17 @@ func (mon *PixelsIOBinding) ButtonInput() gb.ButtonInput {
 		}
 	}
 
+	// F1-F10 save to the quick save slots, and load them with shift held
+	shift := mon.window.Pressed(pixelgl.KeyLeftShift) || mon.window.Pressed(pixelgl.KeyRightShift)
+	for i := 0; i < gb.SlotCount; i++ {
+		if mon.window.JustPressed(pixelgl.KeyF1 + pixelgl.Button(i)) {
+			if shift {
+				buttonInput.Pressed = append(buttonInput.Pressed, gb.ButtonLoadState+gb.Button(i))
+			} else {
+				buttonInput.Pressed = append(buttonInput.Pressed, gb.ButtonSaveState+gb.Button(i))
+			}
+		}
+	}
+
 	return buttonInput
 }
@@ -58,7 +58,7 @@ func (mon *PixelsIOBinding) RenderMemory(gb *gb.Gameboy) {
 
 	for addr := startAddress; addr < endAddress; addr++ {
 
-		value := gb.CPU.Memory.Hram[addr]
+		value := gb.Memory.Hram[addr]
 		addrString := fmt.Sprintf("0x%X: 0x%X", addr, value)
 
 		// textWidth := basicAtlas.TextWidth(addrString)
@@ -3,12 +3,16 @@ package main
 import (
 	"flag"
 	"fmt"
+	"gameboy/audio"
 	"gameboy/gb"
 	"gameboy/io"
 	"gameboy/logger"
+	"gameboy/symbols"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,22 +20,66 @@ import (
 )
 
 var (
-	vsyncOff = flag.Bool("disableVsync", false, "set to disable vsync (debugging)")
-	unlocked = flag.Bool("unlocked", false, "if to unlock the cpu speed (debugging)")
+	vsyncOff  = flag.Bool("disableVsync", false, "set to disable vsync (debugging)")
+	unlocked  = flag.Bool("unlocked", false, "if to unlock the cpu speed (debugging)")
+	mute      = flag.Bool("mute", false, "mute sound output")
+	audioFile = flag.String("audioFile", "", "deprecated, the same as -record-audio file with -mute")
+
+	recordAudio = flag.String("record-audio", "", "record the sound to a file, as wav if it has a .wav extension and raw pcm otherwise")
+
+	rewindBudget   = flag.Int("rewind-budget", gb.DefaultRewindBudget>>20, "megabytes of memory used for rewinding, 0 turns it off")
+	rewindInterval = flag.Int("rewind-interval", gb.DefaultRewindInterval, "number of frames between rewind snapshots")
+
+	trace       = flag.String("trace", "", "write a gameboy-doctor trace of the instructions run to a file")
+	traceFromPC = flag.String("trace-from-pc", "", "start the trace when the CPU reaches this address or label")
+	traceCycle  = flag.Uint64("trace-from-cycle", 0, "start the trace after this many cycles")
+	traceLY     = flag.Bool("trace-doctor-ly", false, "make LY always read 0x90 while tracing, as gameboy-doctor expects")
+	traceSyms   = flag.Bool("trace-symbols", false, "add the label of each instruction from the rom's .sym file to the trace")
+
+	loadState = flag.String("load-state", "", "load a save state file when starting, a quick save slot, a state file or a BESS state from another emulator")
 )
 
+// How long to wait for the emulation to stop and save the game after an exit
+// signal before exiting anyway.
+const exitTimeout = 5 * time.Second
+
+// commands are the subcommands which are run instead of the emulator with
+// "gameboy <command> [arguments]".
+var commands = map[string]func(args []string) error{
+	"debug":  debugCommand,
+	"disasm": disasmCommand,
+	"gdb":    gdbCommand,
+	"info":   infoCommand,
+	"states": statesCommand,
+}
+
+// quit is closed when an exit signal is received, so the emulation can stop
+// and save the game before the program exits.
+var quit = make(chan struct{})
+
 func setupExitHandler() {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM) // Captura Ctrl+C e SIGTERM
 
 	go func() {
 		<-c                                  // Aguarda o sinal
+		close(quit)                          // Pede para a emulação parar e salvar o jogo
+		time.Sleep(exitTimeout)              // Encerra mesmo se a emulação não parar
 		fmt.Print(logger.GetRemainingLogs()) // Exibe os logs restantes
-		os.Exit(0)                           // Encerra o programa
+		os.Exit(1)                           // Encerra o programa
 	}()
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	setupExitHandler()
 
 	// defer func() {
@@ -44,6 +92,11 @@ func main() {
 	flag.Parse()
 	pixelgl.Run(start)
 
+	select {
+	case <-quit:
+		fmt.Print(logger.GetRemainingLogs()) // Exibe os logs restantes
+	default:
+	}
 }
 
 func start() {
@@ -55,33 +108,115 @@ func start() {
 	rom := "./jogos/Pokemon - Gold.gbc"
 	//rom := "./jogos/Tetris.gb"
 	//rom := "./jogos/BombermanGB.gb"
-	//rom := "./gb-test-roms/cpu_instrs/cpu_instrs.gb"
-	//rom := "./gb-test-roms/instr_timing/instr_timing.gb"
-	//rom := "./gb-test-roms/interrupt_time/interrupt_time.gb"
-	//rom := "./gb-test-roms/mem_timing/mem_timing.gb"
-	//rom := "./gb-test-roms/mem_timing-2/rom_singles/01-read_timing.gb"
-	//rom := "./gb-test-roms/mem_timing-2/rom_singles/02-write_timing.gb"
-	//rom := "./gb-test-roms/mem_timing-2/rom_singles/03-modify_timing.gb"
-
-	// if *unlocked {
-	// 	*mute = true
-	// }
+
+	if *unlocked {
+		*mute = true
+	}
+	if *audioFile != "" {
+		log.Print("-audioFile is deprecated, use -record-audio with -mute instead")
+		if *recordAudio == "" {
+			*recordAudio = *audioFile
+		}
+		*mute = true
+	}
 
 	// Initialise the GameBoy with the flag options
 	gameboy, err := gb.NewGameboy(rom, false)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer saveGame(gameboy)
+	gameboy.EnableRewind(*rewindBudget<<20, *rewindInterval)
+
+	if *loadState != "" {
+		if err := gameboy.LoadStateFile(*loadState); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *trace != "" {
+		opts, err := traceOptions(rom)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := gameboy.StartTraceFile(*trace, opts); err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			if err := gameboy.StopTrace(); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
+
+	if *recordAudio != "" {
+		if err := gameboy.StartAudioRecording(*recordAudio); err != nil {
+			log.Fatal(err)
+		}
+		defer gameboy.StopAudioRecording()
+	}
 
 	// Create the monitor for pixels
 	enableVSync := !(*vsyncOff || *unlocked)
 	monitor := io.NewPixelsIOBinding(enableVSync, gameboy)
 
-	emulateCycle(gameboy, monitor)
+	speaker := newAudioBinding()
+	defer speaker.Close()
+
+	emulateCycle(gameboy, monitor, speaker)
+
+}
 
+// traceOptions returns when the trace starts from the flags. The symbols are
+// loaded from the .sym file next to the rom if there is one.
+func traceOptions(rom string) (gb.TraceOptions, error) {
+	opts := gb.TraceOptions{StartCycle: *traceCycle, DoctorLY: *traceLY}
+	syms, err := symbols.ForROM(rom)
+	if err != nil {
+		return opts, err
+	}
+	if *traceSyms {
+		opts.Symbols = syms
+	}
+	if *traceFromPC != "" {
+		if sym, ok := syms.Lookup(*traceFromPC); ok {
+			opts.StartPC, opts.StartAtPC = sym.Address, true
+			return opts, nil
+		}
+		pc, err := strconv.ParseUint(strings.TrimPrefix(*traceFromPC, "0x"), 16, 16)
+		if err != nil {
+			return opts, fmt.Errorf("invalid address %q for -trace-from-pc", *traceFromPC)
+		}
+		opts.StartPC, opts.StartAtPC = uint16(pc), true
+	}
+	return opts, nil
 }
 
-func emulateCycle(gameboy *gb.Gameboy, monitor gb.IOBinding) {
+// newAudioBinding creates the output for the sound based on the flags. If the
+// audio device cannot be opened the emulator carries on muted.
+func newAudioBinding() gb.AudioBinding {
+	if *mute {
+		return audio.NullBinding{}
+	}
+	speaker, err := io.NewOtoAudioBinding()
+	if err != nil {
+		log.Printf("Failed to open audio device: %v", err)
+		return audio.NullBinding{}
+	}
+	return speaker
+}
+
+// saveGame writes the RAM of a cart with a battery to its save file.
+func saveGame(gameboy *gb.Gameboy) {
+	if !gameboy.IsGameLoaded() {
+		return
+	}
+	if err := gameboy.Memory.Cart.Save(); err != nil {
+		log.Print(err)
+	}
+}
+
+func emulateCycle(gameboy *gb.Gameboy, monitor gb.IOBinding, speaker gb.AudioBinding) {
 	frameTime := time.Second / gb.FramesSecond
 
 	if *unlocked {
@@ -97,7 +232,12 @@ func emulateCycle(gameboy *gb.Gameboy, monitor gb.IOBinding) {
 		cartName = gameboy.Memory.Cart.GetName()
 	}
 
-	for range ticker.C {
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
 		if !monitor.IsRunning() {
 			return
 		}
@@ -110,6 +250,7 @@ func emulateCycle(gameboy *gb.Gameboy, monitor gb.IOBinding) {
 		_ = gameboy.Update()
 
 		monitor.Render(&gameboy.PreparedData)
+		speaker.Play(gameboy.AudioSamples())
 
 		since := time.Since(start)
 		if since > time.Second {
@@ -118,6 +259,9 @@ func emulateCycle(gameboy *gb.Gameboy, monitor gb.IOBinding) {
 			title := fmt.Sprintf("Batata - %s (FPS: %2v)", cartName, frames)
 			monitor.SetTitle(title)
 			frames = 0
+
+			// Flush the save regularly so little is lost if the emulator crashes
+			saveGame(gameboy)
 		}
 	}
 }
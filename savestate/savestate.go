@@ -0,0 +1,76 @@
+// Package savestate reads and writes snapshots of the emulated hardware.
+package savestate
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// State is a save state which is either being written or read. Each part of
+// the hardware lists its fields once with Sync, which writes them when
+// saving and reads them back in the same order when loading, so saving and
+// loading can not get out of step.
+type State struct {
+	w   io.Writer
+	r   io.Reader
+	err error
+}
+
+// NewWriter returns a State which saves to w.
+func NewWriter(w io.Writer) *State {
+	return &State{w: w}
+}
+
+// NewReader returns a State which loads from r.
+func NewReader(r io.Reader) *State {
+	return &State{r: r}
+}
+
+// Loading returns if the state is being loaded rather than saved.
+func (s *State) Loading() bool {
+	return s.r != nil
+}
+
+// Err returns the first error which happened while saving or loading.
+func (s *State) Err() error {
+	return s.err
+}
+
+// Sync saves or loads each of the values, which must be pointers to fixed
+// size data or slices of it. Once an error has happened nothing else is
+// saved or loaded.
+func (s *State) Sync(values ...interface{}) {
+	for _, value := range values {
+		if s.err != nil {
+			return
+		}
+		switch v := value.(type) {
+		case *int:
+			s.syncInt(v)
+		case *time.Time:
+			s.syncTime(v)
+		default:
+			if s.Loading() {
+				s.err = binary.Read(s.r, binary.LittleEndian, v)
+			} else {
+				s.err = binary.Write(s.w, binary.LittleEndian, v)
+			}
+		}
+	}
+}
+
+// syncInt saves an int as 64 bits, as its size depends on the platform.
+func (s *State) syncInt(v *int) {
+	n := int64(*v)
+	s.Sync(&n)
+	*v = int(n)
+}
+
+func (s *State) syncTime(v *time.Time) {
+	seconds, nanos := v.Unix(), int64(v.Nanosecond())
+	s.Sync(&seconds, &nanos)
+	if s.Loading() {
+		*v = time.Unix(seconds, nanos)
+	}
+}
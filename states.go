@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gameboy/gb"
+	"os"
+)
+
+// statesCommand lists the quick save slots of a ROM, or exports one of them
+// as a BESS state which other emulators can load.
+func statesCommand(args []string) error {
+	flags := flag.NewFlagSet("states", flag.ExitOnError)
+	export := flags.Int("export", 0, "export the state in this slot as a BESS state")
+	output := flags.String("o", "", "file to write the exported state to")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: gameboy states [-export slot -o file] rom.gb")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected a single rom file")
+	}
+
+	romFile := flags.Arg(0)
+	if *export != 0 {
+		if *output == "" {
+			return errors.New("expected a file to export the state to with -o")
+		}
+		return exportSlot(romFile, *export, *output)
+	}
+
+	slots, err := gb.ListSlots(romFile)
+	if err != nil {
+		return err
+	}
+	if len(slots) == 0 {
+		fmt.Printf("No saved states in %s\n", gb.StateDir(romFile))
+		return nil
+	}
+	for _, slot := range slots {
+		bounds := slot.Thumbnail.Bounds()
+		fmt.Printf("Slot %2d: %s  %d KB  thumbnail %dx%d  %s\n",
+			slot.Slot, slot.Time.Format("2006-01-02 15:04:05"), slot.Size/1024,
+			bounds.Dx(), bounds.Dy(), slot.Path)
+	}
+	return nil
+}
+
+// exportSlot writes the state in a quick save slot to a BESS state file.
+func exportSlot(romFile string, slot int, output string) error {
+	gameboy, err := gb.NewGameboy(romFile, false)
+	if err != nil {
+		return err
+	}
+	if err := gameboy.LoadSlot(slot); err != nil {
+		return err
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := gameboy.SaveBESS(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Exported slot %d to %s\n", slot, output)
+	return nil
+}
@@ -0,0 +1,243 @@
+// Package symbols reads the symbol files written by RGBDS, which give the
+// names of the labels in a ROM.
+package symbols
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AnyBank matches a symbol in any bank.
+const AnyBank = -1
+
+// Symbol is a label at an address in a bank of memory.
+type Symbol struct {
+	Name    string
+	Bank    int
+	Address uint16
+}
+
+// Table is the symbols of a ROM. The methods of a nil table find nothing, so
+// it can be used when there is no symbol file.
+type Table struct {
+	// Sorted by bank then address, keeping the order of the file for
+	// symbols at the same address.
+	symbols []Symbol
+	byName  map[string]Symbol
+	// The banks which have symbols, in order.
+	banks []int
+}
+
+// Parse reads a symbol file, where each line has a bank, an address and a
+// name such as "01:4a10 Main.loop". Comments start with a semicolon.
+func Parse(r io.Reader) (*Table, error) {
+	t := &Table{byName: make(map[string]Symbol)}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, ';'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		sym, err := parseSymbol(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if _, ok := t.byName[sym.Name]; !ok {
+			t.byName[sym.Name] = sym
+		}
+		t.symbols = append(t.symbols, sym)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(t.symbols, func(i, j int) bool {
+		a, b := t.symbols[i], t.symbols[j]
+		if a.Bank != b.Bank {
+			return a.Bank < b.Bank
+		}
+		return a.Address < b.Address
+	})
+	for i, sym := range t.symbols {
+		if i == 0 || sym.Bank != t.symbols[i-1].Bank {
+			t.banks = append(t.banks, sym.Bank)
+		}
+	}
+	return t, nil
+}
+
+func parseSymbol(fields []string) (Symbol, error) {
+	if len(fields) != 2 {
+		return Symbol{}, errors.New("expected bank:address name")
+	}
+	bank, address, ok := strings.Cut(fields[0], ":")
+	if !ok {
+		return Symbol{}, fmt.Errorf("invalid location %q", fields[0])
+	}
+	b, err := strconv.ParseUint(bank, 16, 16)
+	if err != nil {
+		return Symbol{}, fmt.Errorf("invalid bank %q", bank)
+	}
+	a, err := strconv.ParseUint(address, 16, 16)
+	if err != nil {
+		return Symbol{}, fmt.Errorf("invalid address %q", address)
+	}
+	return Symbol{Name: fields[1], Bank: int(b), Address: uint16(a)}, nil
+}
+
+// Load reads a symbol file.
+func Load(filename string) (*Table, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load symbols from %s: %w", filename, err)
+	}
+	return t, nil
+}
+
+// ForROM loads the symbol file next to a ROM, which has the same name with a
+// .sym extension. It returns a nil table if there is no symbol file.
+func ForROM(romFile string) (*Table, error) {
+	filename := strings.TrimSuffix(romFile, filepath.Ext(romFile)) + ".sym"
+	t, err := Load(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return t, err
+}
+
+// Len returns the number of symbols.
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.symbols)
+}
+
+// Lookup finds a symbol by its name.
+func (t *Table) Lookup(name string) (Symbol, bool) {
+	if t == nil {
+		return Symbol{}, false
+	}
+	sym, ok := t.byName[name]
+	return sym, ok
+}
+
+// At returns the first symbol at an address in a bank, or AnyBank.
+func (t *Table) At(bank int, address uint16) (Symbol, bool) {
+	if t == nil {
+		return Symbol{}, false
+	}
+	if bank != AnyBank {
+		return t.at(bank, address)
+	}
+	for _, b := range t.banks {
+		if sym, ok := t.at(b, address); ok {
+			return sym, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// Nearest returns the last symbol at or before an address, in the same bank
+// and the same area of memory, such as the routine an address is in. With
+// AnyBank the closest symbol in any bank is used, from the lowest bank if
+// several are as close.
+func (t *Table) Nearest(bank int, address uint16) (Symbol, bool) {
+	if t == nil {
+		return Symbol{}, false
+	}
+	if bank != AnyBank {
+		return t.nearest(bank, address)
+	}
+	var nearest Symbol
+	found := false
+	for _, b := range t.banks {
+		if sym, ok := t.nearest(b, address); ok && (!found || sym.Address > nearest.Address) {
+			nearest, found = sym, true
+		}
+	}
+	return nearest, found
+}
+
+// search returns the index of the first symbol at or after an address in a
+// bank.
+func (t *Table) search(bank int, address uint16) int {
+	return sort.Search(len(t.symbols), func(i int) bool {
+		sym := t.symbols[i]
+		return sym.Bank > bank || (sym.Bank == bank && sym.Address >= address)
+	})
+}
+
+func (t *Table) at(bank int, address uint16) (Symbol, bool) {
+	i := t.search(bank, address)
+	if i < len(t.symbols) && t.symbols[i].Bank == bank && t.symbols[i].Address == address {
+		return t.symbols[i], true
+	}
+	return Symbol{}, false
+}
+
+func (t *Table) nearest(bank int, address uint16) (Symbol, bool) {
+	// The last symbol at or before the address
+	i := sort.Search(len(t.symbols), func(i int) bool {
+		sym := t.symbols[i]
+		return sym.Bank > bank || (sym.Bank == bank && sym.Address > address)
+	}) - 1
+	if i < 0 || t.symbols[i].Bank != bank || area(t.symbols[i].Address) != area(address) {
+		return Symbol{}, false
+	}
+	// The first of the symbols at its address
+	return t.at(bank, t.symbols[i].Address)
+}
+
+// Describe returns the nearest symbol to an address with the offset from it,
+// such as "Main.loop" or "Main.loop+$3", or "" if there is no symbol before
+// the address.
+func (t *Table) Describe(bank int, address uint16) string {
+	sym, ok := t.Nearest(bank, address)
+	if !ok {
+		return ""
+	}
+	if sym.Address == address {
+		return sym.Name
+	}
+	return fmt.Sprintf("%s+$%X", sym.Name, address-sym.Address)
+}
+
+// area returns which area of the memory map an address is in, so a symbol
+// in one area is not used for an address in another.
+func area(address uint16) int {
+	switch {
+	case address < 0x4000:
+		return 0 // ROM bank 0
+	case address < 0x8000:
+		return 1 // Switchable ROM bank
+	case address < 0xA000:
+		return 2 // VRAM
+	case address < 0xC000:
+		return 3 // Cart RAM
+	case address < 0xD000:
+		return 4 // WRAM bank 0
+	case address < 0xE000:
+		return 5 // Switchable WRAM bank
+	case address < 0xFF80:
+		return 6 // OAM and registers
+	default:
+		return 7 // HRAM
+	}
+}
@@ -0,0 +1,115 @@
+package symbols
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSymbols = `; File generated by rgblink
+00:0150 Start
+00:0150 Start.alias
+00:0200 Init ; comment
+01:4000 Main
+01:4010 Main.loop
+02:4000 Other
+02:4008 Other.loop
+00:c000 wBuffer
+00:ff80 hTemp
+`
+
+func parseTest(t *testing.T) *Table {
+	table, err := Parse(strings.NewReader(testSymbols))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func TestParse(t *testing.T) {
+	table := parseTest(t)
+	if table.Len() != 9 {
+		t.Errorf("got %d symbols, want 9", table.Len())
+	}
+	want := Symbol{Name: "Main.loop", Bank: 1, Address: 0x4010}
+	if sym, ok := table.Lookup("Main.loop"); !ok || sym != want {
+		t.Errorf("got %v, %v for Main.loop, want %v", sym, ok, want)
+	}
+	if _, ok := table.Lookup("Missing"); ok {
+		t.Error("found a symbol which is not in the file")
+	}
+
+	for _, bad := range []string{"0150 Start", "00:0150", "xx:0150 Start", "00:zzzz Start", "00:0150 Start extra"} {
+		if _, err := Parse(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q parsed without an error", bad)
+		}
+	}
+}
+
+func TestAt(t *testing.T) {
+	table := parseTest(t)
+	tests := []struct {
+		bank    int
+		address uint16
+		want    string
+	}{
+		{0, 0x0150, "Start"},
+		{0, 0x0151, ""},
+		{1, 0x4000, "Main"},
+		{2, 0x4000, "Other"},
+		{3, 0x4000, ""},
+		{AnyBank, 0x4000, "Main"},
+		{AnyBank, 0x4008, "Other.loop"},
+		{AnyBank, 0x4009, ""},
+	}
+	for _, test := range tests {
+		sym, _ := table.At(test.bank, test.address)
+		if sym.Name != test.want {
+			t.Errorf("At(%d, %04X) = %q, want %q", test.bank, test.address, sym.Name, test.want)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	table := parseTest(t)
+	tests := []struct {
+		bank    int
+		address uint16
+		want    string
+	}{
+		{0, 0x0100, ""},
+		{0, 0x0150, "Start"},
+		{0, 0x01FF, "Start+$AF"},
+		{0, 0x3FFF, "Init+$3DFF"},
+		// Symbols in bank 0 are not used for the switchable bank
+		{0, 0x4000, ""},
+		{1, 0x4000, "Main"},
+		{1, 0x4012, "Main.loop+$2"},
+		{1, 0x7FFF, "Main.loop+$3FEF"},
+		{2, 0x4009, "Other.loop+$1"},
+		{1, 0x8000, ""},
+		{3, 0x4000, ""},
+		// The closest in any bank
+		{AnyBank, 0x4009, "Other.loop+$1"},
+		{AnyBank, 0x4011, "Main.loop+$1"},
+		{AnyBank, 0x4000, "Main"},
+		{0, 0xC010, "wBuffer+$10"},
+		{0, 0xFF7F, ""},
+		{0, 0xFF80, "hTemp"},
+		{0, 0xFFFF, "hTemp+$7F"},
+	}
+	for _, test := range tests {
+		if got := table.Describe(test.bank, test.address); got != test.want {
+			t.Errorf("Describe(%d, %04X) = %q, want %q", test.bank, test.address, got, test.want)
+		}
+	}
+}
+
+func TestNilTable(t *testing.T) {
+	var table *Table
+	if _, ok := table.Nearest(0, 0x150); ok {
+		t.Error("a nil table found a symbol")
+	}
+	if got := table.Describe(AnyBank, 0x150); got != "" {
+		t.Errorf("got %q from a nil table", got)
+	}
+}